@@ -1,9 +1,11 @@
 package beam
 
 import (
-	"encoding/json"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
+	"reflect"
 	"sort"
 	"sync"
 	"time"
@@ -11,154 +13,595 @@ import (
 
 // FeedSource represents a source feed with metadata
 type FeedSource struct {
+	ID          string    `json:"id"`
 	URL         string    `json:"url"`
+	HomePageURL string    `json:"home_page_url,omitempty"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
+	Group       string    `json:"group,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Disabled    bool      `json:"disabled,omitempty"`
 	LastFetch   time.Time `json:"last_fetch"`
-	Status      string    `json:"status"` // "active", "error", "timeout"
+	Status      string    `json:"status"` // "new", "active", "error", "timeout", "disabled"
 	ErrorMsg    string    `json:"error_msg,omitempty"`
+	Hub         string    `json:"hub,omitempty"`        // WebSub hub advertised by the feed
+	Backfilled  bool      `json:"backfilled,omitempty"` // whether the feed's archive pages were fetched
+
+	// Validators of the last successful fetch, sent on conditional requests
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// Cursor of the last response from a feed supporting incremental
+	// fetches, sent as X-Beam-Since to receive only the changes after it
+	SinceCursor string `json:"since_cursor,omitempty"`
+	// Time of the last fetch of the whole feed. Deltas do not tell which
+	// entries rotated out of the feed, so the whole feed is fetched again
+	// once this is older than fullFetchInterval.
+	LastFullFetch time.Time `json:"last_full_fetch"`
 }
 
+// fullFetchInterval is how long a source supporting incremental fetches
+// is fetched with deltas before it is fetched whole again
+const fullFetchInterval = 24 * time.Hour
+
+// maxAggregatedTombstones bounds the tombstones of the aggregated feed;
+// the oldest are forgotten first
+const maxAggregatedTombstones = 1000
+
 // Aggregator manages multiple BEAM feeds and creates aggregated content
 type Aggregator struct {
-	Sources        []FeedSource `json:"sources"`
-	AggregatedFeed *Feed        `json:"-"`
-	mu             sync.RWMutex
-	fetchTimeout   time.Duration
+	Sources         []FeedSource `json:"sources"`
+	AggregatedFeed  *Feed        `json:"-"`
+	mu              sync.RWMutex
+	history         *entryHistory
+	tombstones      []Tombstone // entries gone from the aggregated feed, oldest first
+	retention       RetentionPolicy
+	lastChanges     []Changeset
+	changeHooks     changeHooks
+	events          eventBus
+	websub          websubSubscriber
+	store           Store
+	persister       statePersister
+	fetchTimeout    time.Duration
+	maxEntries      int
+	language        string
+	filter          EntryFilter
+	pages           *Pages
+	sanitizer       *SanitizePolicy
+	excerptLength   int
+	extractImages   bool
+	refreshMu       sync.Mutex
+	refreshStop     chan struct{}
+	refreshInterval time.Duration
 }
 
 // NewAggregator creates a new feed aggregator
 func NewAggregator(title, feedURL string) *Aggregator {
+	sanitizer := DefaultSanitizePolicy
 	return &Aggregator{
 		Sources:        make([]FeedSource, 0),
 		AggregatedFeed: NewFeed(title, feedURL),
+		history:        newEntryHistory(),
 		fetchTimeout:   30 * time.Second,
+		maxEntries:     100,
+		language:       "en-US",
+		sanitizer:      &sanitizer,
+		excerptLength:  DefaultExcerptLength,
 	}
 }
 
-// AddSource adds a new feed source to the aggregator
-func (a *Aggregator) AddSource(name, description, url string) {
+// SetFetchTimeout sets the timeout applied to each source fetch
+func (a *Aggregator) SetFetchTimeout(timeout time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.fetchTimeout = timeout
+}
+
+// SetMaxEntries sets the maximum number of entries in the aggregated feed
+func (a *Aggregator) SetMaxEntries(maxEntries int) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	a.maxEntries = maxEntries
+}
+
+// SetSanitizePolicy sets the policy that the content of source entries is
+// sanitized with when they are fetched, DefaultSanitizePolicy by default.
+// nil keeps the content as published, for trusted sources only.
+func (a *Aggregator) SetSanitizePolicy(policy *SanitizePolicy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sanitizer = policy
+}
 
-	a.Sources = append(a.Sources, FeedSource{
+// SetExcerptLength sets the length of the excerpts of the content that
+// entries without a summary get in the aggregated feed. 0 disables excerpts.
+func (a *Aggregator) SetExcerptLength(length int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.excerptLength = length
+}
+
+// SetImageExtraction sets whether entries without a featured image get the
+// first meaningful image of their content in the aggregated feed. It is
+// off by default.
+func (a *Aggregator) SetImageExtraction(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.extractImages = enabled
+}
+
+// SetLanguage sets the language of the aggregated feed
+func (a *Aggregator) SetLanguage(language string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.language = language
+}
+
+// SetFilter sets the filter entries must pass to be aggregated
+func (a *Aggregator) SetFilter(filter EntryFilter) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.filter = filter
+}
+
+// AddSource adds a new feed source to the aggregator and returns its ID.
+// The URL may point at a feed or at a web page; pages are resolved to
+// their preferred feed through discovery on the first fetch. Adding a URL
+// that is already a source returns the existing ID and ErrDuplicateSource.
+func (a *Aggregator) AddSource(name, description, url string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id, err := a.addSourceLocked(FeedSource{
 		URL:         url,
 		Name:        name,
 		Description: description,
-		Status:      "new",
 	})
+	if err != nil {
+		return id, err
+	}
 
 	fmt.Printf("Added source: %s (%s)\n", name, url)
+	a.persistLocked()
+	a.publishSourceEvent(EventSourceAdded, a.Sources[len(a.Sources)-1], nil)
+	return id, nil
 }
 
-// FetchAllFeeds fetches all source feeds concurrently
+// FetchAllFeeds fetches all source feeds concurrently and rebuilds the
+// aggregated feed from the entry history, so entries that publishers have
+// rotated out of their feeds are kept until the retention policy drops them.
+//
+// The changes of each source are available from LastChanges afterwards
+// and are passed to the callbacks registered with OnChange.
 func (a *Aggregator) FetchAllFeeds() error {
+	return a.fetchFeeds(false)
+}
+
+// fetchFeeds fetches the enabled sources and runs the OnChange callbacks.
+// With skipPushed, sources whose updates a WebSub hub pushes are left out.
+func (a *Aggregator) fetchFeeds(skipPushed bool) error {
 	a.mu.Lock()
-	defer a.mu.Unlock()
+	changesets := a.fetchAllLocked(skipPushed)
+	a.mu.Unlock()
 
-	fmt.Printf("Fetching %d source feeds...\n", len(a.Sources))
+	a.notifyChanges(changesets)
+	return nil
+}
+
+// fetchAllLocked fetches every enabled source, updates the history and
+// rebuilds the aggregated feed. It returns the non-empty changesets.
+// The caller must hold a.mu for writing.
+func (a *Aggregator) fetchAllLocked(skipPushed bool) []Changeset {
+	var due []int
+	for i, source := range a.Sources {
+		// Disabled sources are not fetched and contribute no entries
+		if source.Disabled {
+			continue
+		}
+		// Sources with a live WebSub subscription need no polling
+		if skipPushed && a.websub.isPushed(source.ID, time.Now()) {
+			continue
+		}
+		due = append(due, i)
+	}
+
+	fmt.Printf("Fetching %d source feeds...\n", len(due))
 
 	type fetchResult struct {
-		index int
-		feed  *Feed
-		err   error
+		index  int
+		result sourceFetch
+		err    error
 	}
 
-	results := make(chan fetchResult, len(a.Sources))
-	for i, source := range a.Sources {
+	results := make(chan fetchResult, len(due))
+	for _, i := range due {
+		source := a.Sources[i]
+		// Without entries to fall back on, a 304 would leave the source empty
+		if !a.history.hasSource(source.ID) {
+			source.ETag, source.LastModified = "", ""
+			source.SinceCursor = ""
+		}
+		if time.Since(source.LastFullFetch) > fullFetchInterval {
+			source.SinceCursor = ""
+		}
+		a.publishSourceEvent(EventFetchStarted, source, nil)
 		go func(index int, src FeedSource) {
-			feed, err := a.fetchFeedWithTimeout(src.URL)
-			results <- fetchResult{index: index, feed: feed, err: err}
+			result, err := a.fetchFeedWithTimeout(src)
+			results <- fetchResult{index: index, result: result, err: err}
 		}(i, source)
 	}
 
-	var allEntries []Entry
 	successCount := 0
+	var changesets []Changeset
 
 	// Wait for all goroutines to complete
-	for i := 0; i < len(a.Sources); i++ {
-		result := <-results
-		a.Sources[result.index].LastFetch = time.Now()
-		if result.err != nil {
-			a.Sources[result.index].Status = "error"
-			a.Sources[result.index].ErrorMsg = result.err.Error()
-			fmt.Printf("Failed to fetch %s: %v\n", a.Sources[result.index].Name, result.err)
+	for range due {
+		fetched := <-results
+		src := &a.Sources[fetched.index]
+		src.LastFetch = time.Now()
+		if fetched.err != nil {
+			src.Status = "error"
+			src.ErrorMsg = fetched.err.Error()
+			fmt.Printf("Failed to fetch %s: %v\n", src.Name, fetched.err)
+			a.publishSourceEvent(EventFetchFailed, *src, fetched.err)
 			continue
 		}
 
-		a.Sources[result.index].Status = "active"
-		a.Sources[result.index].ErrorMsg = ""
+		src.Status = "active"
+		src.ErrorMsg = ""
+		src.ETag, src.LastModified = fetched.result.etag, fetched.result.lastModified
+		src.SinceCursor = fetched.result.cursor
+		if fetched.result.full {
+			src.LastFullFetch = src.LastFetch
+		}
 		successCount++
 
+		if fetched.result.notModified {
+			a.history.touch(src.ID, src.LastFetch)
+			a.subscribeLocked(*src, "")
+			fmt.Printf("✓ %s not modified\n", src.Name)
+			a.publishSourceEvent(EventFetchSucceeded, *src, nil)
+			continue
+		}
+
+		// A home page was resolved to one of its feeds; remember both
+		if fetched.result.feedURL != src.URL {
+			fmt.Printf("Discovered feed %s for %s\n", fetched.result.feedURL, src.URL)
+			src.HomePageURL = src.URL
+			src.URL = fetched.result.feedURL
+		}
+		src.Hub = fetched.result.hub
+		a.subscribeLocked(*src, fetched.result.topic)
+
+		a.sanitizeLocked(fetched.result.feed.Items)
+		a.sanitizeLocked(fetched.result.archived)
+
+		// Entries deleted by the publisher are dropped from the history, and
+		// a delta only holds the entries that changed
+		retracted := a.history.retract(src.ID, fetched.result.feed.Tombstones)
+		var changeset Changeset
+		if fetched.result.delta {
+			changeset = a.history.merge(src.ID, fetched.result.feed.Items, src.LastFetch)
+			a.history.touch(src.ID, src.LastFetch)
+		} else {
+			changeset = a.history.observe(src.ID, fetched.result.feed.Items, src.LastFetch)
+		}
+		changeset.addRetracted(retracted)
+		if archived := fetched.result.archived; len(archived) > 0 {
+			changeset.Backfilled = a.history.backfill(src.ID, archived, src.LastFetch)
+			fmt.Printf("✓ Backfilled %d archived entries from %s\n", len(archived), src.Name)
+		}
+		src.Backfilled = src.Backfilled || fetched.result.backfilled
+		if !changeset.IsEmpty() {
+			changesets = append(changesets, changeset)
+		}
+		fmt.Printf("✓ Fetched %d entries from %s (%d new, %d updated, %d removed)\n",
+			len(fetched.result.feed.Items), src.Name, len(changeset.New), len(changeset.Updated), len(changeset.Removed))
+		a.publishSourceEvent(EventFetchSucceeded, *src, nil)
+	}
+
+	fmt.Printf("Successfully fetched %d/%d feeds\n", successCount, len(due))
+
+	a.finishRefreshLocked(changesets)
+	return changesets
+}
+
+// sanitizeLocked sanitizes the content of entries received from a source,
+// resolving relative links against each entry's URL.
+// The caller must hold a.mu.
+func (a *Aggregator) sanitizeLocked(entries []Entry) {
+	if a.sanitizer == nil {
+		return
+	}
+	for i := range entries {
+		if entries[i].Content != "" {
+			entries[i].Content = a.sanitizer.Sanitize(entries[i].Content, entries[i].URL)
+		}
+	}
+}
+
+// finishRefreshLocked applies the retention policy, rebuilds and persists
+// the aggregated feed and publishes the changes of a refresh.
+// The caller must hold a.mu for writing.
+func (a *Aggregator) finishRefreshLocked(changesets []Changeset) {
+	if dropped := a.history.prune(a.retention, time.Now()); dropped > 0 {
+		fmt.Printf("Dropped %d entries from history\n", dropped)
+	}
+	a.rebuildLocked()
+	a.persistLocked()
+	a.lastChanges = changesets
+
+	a.publishEntryEventsLocked(changesets)
+	a.events.publish(Event{Type: EventAggregationCompleted, EntryCount: len(a.AggregatedFeed.Items)})
+}
+
+// rebuildLocked recreates the aggregated feed from the entry history of
+// every enabled source, with tombstones for the entries that left it for
+// good. If nothing changed the previous feed is kept, so its version and
+// validators stay the same. The caller must hold a.mu for writing.
+func (a *Aggregator) rebuildLocked() {
+	var allEntries []Entry
+	enabled := 0
+	kept := make(map[string]bool)
+
+	for _, src := range a.Sources {
+		if src.Disabled {
+			continue
+		}
+		enabled++
+
 		// Add source information to entries and collect them
-		for _, entry := range result.feed.Items {
-			// Create a copy of the entry with source information
-			enrichedEntry := entry
-
-			// Add source information as custom fields (using underscore prefix for extensions)
-			// Note: In a real implementation, you might want to extend the Entry struct
-			// For now, we'll add source info to the summary if it exists
-			if enrichedEntry.Summary != "" {
-				enrichedEntry.Summary = fmt.Sprintf("[%s] %s", a.Sources[result.index].Name, enrichedEntry.Summary)
-			} else {
-				enrichedEntry.Summary = fmt.Sprintf("From %s", a.Sources[result.index].Name)
+		for _, record := range a.history.sourceRecords(src.ID) {
+			kept[record.Entry.ID] = true
+			enrichedEntry := a.enrichEntryLocked(src, record.Entry)
+			if !a.filter.Match(enrichedEntry) {
+				continue
 			}
+			// Deltas of the aggregated feed follow the history, not the rebuild
+			enrichedEntry.changed = record.Changed
 			allEntries = append(allEntries, enrichedEntry)
 		}
-
-		fmt.Printf("✓ Fetched %d entries from %s\n", len(result.feed.Items), a.Sources[result.index].Name)
 	}
 
-	fmt.Printf("Successfully fetched %d/%d feeds\n", successCount, len(a.Sources))
-
-	// Sort entries by publication date (newest first)
-	sort.Slice(allEntries, func(i, j int) bool {
+	// Sort entries by publication date (newest first), keeping the order of
+	// ties so an unchanged history rebuilds the same feed
+	sort.SliceStable(allEntries, func(i, j int) bool {
 		return allEntries[i].Published.After(allEntries[j].Published)
 	})
 
-	// Limit to most recent entries (e.g., last 100)
-	maxEntries := 100
-	if len(allEntries) > maxEntries {
-		allEntries = allEntries[:maxEntries]
+	// Limit to most recent entries
+	if a.maxEntries > 0 && len(allEntries) > a.maxEntries {
+		allEntries = allEntries[:a.maxEntries]
 	}
 
 	// Create new aggregated feed
-	aggregatedFeed := NewFeed(a.AggregatedFeed.Title, a.AggregatedFeed.FeedURL)
-	aggregatedFeed.SetDescription(fmt.Sprintf("Aggregated content from %d sources", len(a.Sources)))
-	aggregatedFeed.SetLanguage("en-US")
+	previous := a.AggregatedFeed
+	aggregatedFeed := NewFeed(previous.Title, previous.FeedURL)
+	aggregatedFeed.LastUpdated = previous.LastUpdated
+	changedAt := aggregatedFeed.markChanged()
+	aggregatedFeed.SetDescription(fmt.Sprintf("Aggregated content from %d sources", enabled))
+	aggregatedFeed.SetLanguage(a.language)
+	aggregatedFeed.SetPages(a.pages)
+
+	// Add all entries to the aggregated feed, keeping their change times
+	aggregatedFeed.Items = append(aggregatedFeed.Items, allEntries...)
+	a.buryLocked(kept, changedAt)
+	aggregatedFeed.Tombstones = append(aggregatedFeed.Tombstones, a.tombstones...)
+
+	if sameFeedContent(previous, aggregatedFeed) {
+		return
+	}
+	a.AggregatedFeed = aggregatedFeed
+}
+
+// sameFeedContent reports whether two versions of a feed have the same
+// metadata, entries and tombstones
+func sameFeedContent(a, b *Feed) bool {
+	return a.Title == b.Title && a.Description == b.Description && a.HomePageURL == b.HomePageURL &&
+		a.FeedURL == b.FeedURL && a.Language == b.Language && a.Hub == b.Hub && a.pages == b.pages &&
+		reflect.DeepEqual(a.Author, b.Author) &&
+		reflect.DeepEqual(a.Items, b.Items) &&
+		reflect.DeepEqual(a.Tombstones, b.Tombstones)
+}
+
+// buryLocked records tombstones for the entries of the aggregated feed that
+// are no longer kept in the history of an enabled source: those deleted by
+// their publisher, dropped by the retention policy, or of a source that was
+// removed or disabled. Tombstones of entries that are kept again are
+// dropped. The caller must hold a.mu for writing.
+func (a *Aggregator) buryLocked(kept map[string]bool, deleted time.Time) {
+	var tombstones []Tombstone
+	buried := make(map[string]bool)
+	for _, tombstone := range a.tombstones {
+		if !kept[tombstone.ID] {
+			tombstones = append(tombstones, tombstone)
+			buried[tombstone.ID] = true
+		}
+	}
+	for _, entry := range a.AggregatedFeed.Items {
+		if !kept[entry.ID] && !buried[entry.ID] {
+			tombstones = append(tombstones, Tombstone{ID: entry.ID, Deleted: deleted})
+			buried[entry.ID] = true
+		}
+	}
+	if len(tombstones) > maxAggregatedTombstones {
+		tombstones = tombstones[len(tombstones)-maxAggregatedTombstones:]
+	}
+	a.tombstones = tombstones
+}
 
-	// Add all entries to the aggregated feed
-	for _, entry := range allEntries {
-		aggregatedFeed.AddEntry(entry)
+// enrichEntryLocked returns a copy of a source entry as it appears in the
+// aggregated feed. The caller must hold a.mu.
+func (a *Aggregator) enrichEntryLocked(src FeedSource, entry Entry) Entry {
+	// Create a copy of the entry with source information
+	enrichedEntry := entry
+	enrichedEntry.Extensions = make(ExtensionFields, len(entry.Extensions)+1)
+	for key, value := range entry.Extensions {
+		enrichedEntry.Extensions[key] = value
 	}
 
-	a.AggregatedFeed = aggregatedFeed
-	return nil
+	if enrichedEntry.Image == "" && a.extractImages {
+		if info, ok := ExtractImage(enrichedEntry.Content, enrichedEntry.URL); ok {
+			enrichedEntry.SetImageInfo(info)
+		}
+	}
+
+	// Prefix the summary with the source name and record the source
+	// ID as an extension so consumers can tell entries apart. Entries
+	// without a summary get an excerpt of their content.
+	if enrichedEntry.Summary == "" && a.excerptLength > 0 {
+		enrichedEntry.Summary = Excerpt(enrichedEntry.Content, a.excerptLength)
+	}
+	if enrichedEntry.Summary != "" {
+		enrichedEntry.Summary = fmt.Sprintf("[%s] %s", src.Name, enrichedEntry.Summary)
+	} else {
+		enrichedEntry.Summary = fmt.Sprintf("From %s", src.Name)
+	}
+	enrichedEntry.SetExtension(KindSourceExtension, src.ID)
+	return enrichedEntry
 }
 
-// fetchFeedWithTimeout fetches a feed with a timeout
-func (a *Aggregator) fetchFeedWithTimeout(url string) (*Feed, error) {
+// sourceFetch is the outcome of fetching a single source
+type sourceFetch struct {
+	feed         *Feed
+	feedURL      string
+	notModified  bool
+	etag         string
+	lastModified string
+	hub          string // WebSub hub advertised by the feed
+	topic        string // WebSub topic URL of the feed
+	archived     []Entry
+	backfilled   bool
+	cursor       string // sync cursor for the next incremental fetch
+	delta        bool   // whether feed only holds the changes since the source's cursor
+	full         bool   // whether the whole feed was asked for, without a cursor
+}
+
+// fetchFeedWithTimeout fetches a source feed with a timeout, sending the
+// validators of the previous fetch so unchanged feeds cost a 304.
+// If the source URL serves an HTML page, the page's preferred feed is
+// discovered and fetched instead. Until a source has been backfilled, the
+// archive pages of its feed are fetched too. Feeds that returned a sync
+// cursor are asked for the changes since it only.
+func (a *Aggregator) fetchFeedWithTimeout(src FeedSource) (sourceFetch, error) {
 	client := &http.Client{Timeout: a.fetchTimeout}
-	resp, err := client.Get(url)
+	url, since := src.URL, src.SinceCursor
+
+	doc, err := fetchDocument(client, url, src.ETag, src.LastModified, since)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return sourceFetch{}, err
+	}
+	if doc.notModified {
+		return sourceFetch{feedURL: url, notModified: true, etag: src.ETag, lastModified: src.LastModified, cursor: src.SinceCursor, full: since == ""}, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+	if doc.isHTML {
+		candidates := discoverFeeds(client, url, doc.body)
+		if len(candidates) == 0 {
+			return sourceFetch{}, fmt.Errorf("feed discovery failed: %w", ErrNoFeedFound)
+		}
+		url, since = candidates[0].URL, ""
+		if doc, err = fetchDocument(client, url, "", "", ""); err != nil {
+			return sourceFetch{}, err
+		}
+	}
+
+	feed, err := ParseFeed(doc.body, url)
+	if err != nil {
+		return sourceFetch{}, fmt.Errorf("feed parse error: %w", err)
+	}
+
+	// Link headers take precedence over links inside the document
+	hub, topic := doc.hub, doc.self
+	if hub == "" {
+		hub = feed.Hub
+	}
+	if topic == "" {
+		topic = feed.FeedURL
+	}
+	result := sourceFetch{
+		feed:         feed,
+		feedURL:      url,
+		etag:         doc.etag,
+		lastModified: doc.lastModified,
+		hub:          hub,
+		topic:        topic,
+		cursor:       doc.cursor,
+	}
+	// Servers without incremental fetches ignore the header and send the
+	// whole feed without a cursor
+	result.delta = since != "" && doc.cursor != ""
+	result.full = !result.delta
+
+	// A failed backfill keeps the pages fetched so far and is retried
+	if !src.Backfilled {
+		archived, _, err := walkFeedPages(client, feed, nil)
+		if err != nil {
+			fmt.Printf("Backfill of %s incomplete: %v\n", src.Name, err)
+		}
+		result.archived, result.backfilled = archived, err == nil
+	}
+	return result, nil
+}
+
+// fetchedDocument is a document retrieved by fetchDocument
+type fetchedDocument struct {
+	body         []byte
+	isHTML       bool
+	notModified  bool
+	etag         string
+	lastModified string
+	hub          string // target of a rel="hub" Link header
+	self         string // target of a rel="self" Link header
+	cursor       string // sync cursor of an incremental fetch, see CursorHeader
+}
+
+// fetchDocument fetches url with feed content negotiation, as a
+// conditional request when validators are given and for the changes after
+// since when it is set. It reports whether the response is an HTML page
+// rather than a feed.
+func fetchDocument(client *http.Client, url, etag, lastModified, since string) (fetchedDocument, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fetchedDocument{}, fmt.Errorf("invalid request: %w", err)
+	}
+	req.Header.Set("Accept", feedAcceptHeader)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	if since != "" {
+		req.Header.Set(SinceHeader, since)
 	}
 
-	var feed Feed
-	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
-		return nil, fmt.Errorf("JSON decode error: %w", err)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fetchedDocument{}, fmt.Errorf("HTTP request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
-	if err := feed.Validate(); err != nil {
-		return nil, fmt.Errorf("feed validation error: %w", err)
+	if resp.StatusCode == http.StatusNotModified {
+		return fetchedDocument{notModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fetchedDocument{}, fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
 	}
 
-	return &feed, nil
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fetchedDocument{}, fmt.Errorf("read error: %w", err)
+	}
+	return fetchedDocument{
+		body:         body,
+		isHTML:       isHTMLResponse(resp),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		hub:          linkHeaderTarget(resp, "hub"),
+		self:         linkHeaderTarget(resp, "self"),
+		cursor:       resp.Header.Get(CursorHeader),
+	}, nil
 }
 
 // GetStats returns aggregation statistics
@@ -167,9 +610,10 @@ func (a *Aggregator) GetStats() map[string]any {
 	defer a.mu.RUnlock()
 
 	var (
-		activeCount  = 0
-		errorCount   = 0
-		totalEntries = 0
+		activeCount   = 0
+		errorCount    = 0
+		disabledCount = 0
+		totalEntries  = 0
 	)
 
 	for _, source := range a.Sources {
@@ -178,6 +622,8 @@ func (a *Aggregator) GetStats() map[string]any {
 			activeCount++
 		case "error":
 			errorCount++
+		case "disabled":
+			disabledCount++
 		}
 	}
 
@@ -186,15 +632,18 @@ func (a *Aggregator) GetStats() map[string]any {
 	}
 
 	return map[string]any{
-		"total_sources":  len(a.Sources),
-		"active_sources": activeCount,
-		"error_sources":  errorCount,
-		"total_entries":  totalEntries,
-		"last_updated":   a.AggregatedFeed.LastUpdated,
+		"total_sources":    len(a.Sources),
+		"active_sources":   activeCount,
+		"error_sources":    errorCount,
+		"disabled_sources": disabledCount,
+		"total_entries":    totalEntries,
+		"last_updated":     a.AggregatedFeed.LastUpdated,
 	}
 }
 
-// ServeHTTP implements http.Handler for the aggregator
+// ServeHTTP implements http.Handler for the aggregator, serving the
+// aggregated feed with the formats and query parameters of Feed.ServeHTTP.
+// The source parameter selects entries by source ID.
 func (a *Aggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
@@ -207,76 +656,86 @@ func (a *Aggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.AggregatedFeed.ServeHTTP(w, r)
 }
 
-// HomePage serves the aggregator's home page with feed information
-// It displays the feed sources, last updated time, and recent entries
-// in a simple HTML format.
+// HomePage serves the aggregator's HTML page listing its sources and
+// most recent entries, and the permalink page of an entry for
+// ?entry=<id>&source=<source id>
 func (a *Aggregator) HomePage(w http.ResponseWriter, r *http.Request) {
-	html := `
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<title>BEAM Aggregator Example</title>
-			<style>
-				body { font-family: Arial, sans-serif; margin: 40px; background: #f9f9f9; }
-				.feed-info { margin: 20px 0; }
-				.entry { border: 1px solid #ddd; margin: 10px 0; padding: 15px; border-radius: 5px; background: #fff; }
-				.tags { color: #666; font-size: 0.9em; }
-				.source { font-size: 0.9em; color: #888; }
-			</style>
-		</head>
-		<body>
-			<h1>BEAM Aggregator Example</h1>
-			<p>This is a demonstration of the BEAM (Blog Entry Aggregation Method) protocol.</p>
-			<p><strong>Feed URL:</strong> <a href="/feed.json">/feed.json</a></p> <hr/>
-			<p>Last Updated: <strong>` + a.AggregatedFeed.LastUpdated.Local().Format(time.DateTime) + `</strong></p>
-			<h2>Sources</h2>
-			<ul>`
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 
-	for _, src := range a.Sources {
-		html += fmt.Sprintf("<li><strong>%s</strong> - <a href=\"%s\">%s</a> <span class=\"source\">(%s)</span></li>", src.Name, src.URL, src.URL, src.Description)
-	}
-
-	html += `</ul><hr/><h3>Recent Entries</h3>`
-	if a.AggregatedFeed != nil && len(a.AggregatedFeed.Items) > 0 {
-		maxEntries := min(15, len(a.AggregatedFeed.Items))
-		for _, entry := range a.AggregatedFeed.Items[:maxEntries] {
-			html += `<div class="entry">`
-			html += fmt.Sprintf("<h4><a href=\"%s\">%s</a></h4>", entry.URL, entry.Title)
-			html += fmt.Sprintf("<div class=\"source\">Published: %s</div>", entry.Published.Format("2006-01-02 15:04"))
-			if entry.Summary != "" {
-				html += fmt.Sprintf("<p>%s</p>", entry.Summary)
-			}
-			if len(entry.Tags) > 0 {
-				html += fmt.Sprintf("<div class=\"tags\">Tags: %v</div>", entry.Tags)
-			}
-			html += `</div>`
-		}
-	} else {
-		html += `<p>No entries available.</p>`
+	if a.AggregatedFeed == nil {
+		http.Error(w, "Aggregated feed not available", http.StatusServiceUnavailable)
+		return
 	}
 
-	html += `</body></html>`
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+	feed := a.AggregatedFeed
+	pagesOrDefault(a.pages).serve(w, r, "aggregator", PageData{
+		Feed:           feed,
+		Entries:        feed.Items[:min(maxHomePageEntries, len(feed.Items))],
+		Sources:        a.Sources,
+		AlternateLinks: template.HTML(feed.AlternateLinks()),
+	})
+}
+
+// SetPages sets the templates and theme of the aggregator's HTML pages,
+// which are also used for the HTML format of the aggregated feed.
+// nil restores the default pages.
+func (a *Aggregator) SetPages(pages *Pages) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pages = pages
+	if a.AggregatedFeed != nil {
+		a.AggregatedFeed.SetPages(pages)
+	}
 }
 
-// StartAutoRefresh starts automatic feed refresh in the background
+// StartAutoRefresh starts automatic feed refresh in the background.
+// Sources whose updates are pushed through WebSub are only polled when
+// their subscription needs renewing.
+// Calling it again replaces the running refresh loop.
 func (a *Aggregator) StartAutoRefresh(interval time.Duration) {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	if a.refreshStop != nil {
+		close(a.refreshStop)
+	}
+	stop := make(chan struct{})
+	a.refreshStop, a.refreshInterval = stop, interval
+
 	ticker := time.NewTicker(interval)
 	go func() {
-		for range ticker.C {
-			fmt.Println("Starting automatic feed refresh...")
-			if err := a.FetchAllFeeds(); err != nil {
-				fmt.Printf("Auto-refresh error: %v\n", err)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				fmt.Println("Starting automatic feed refresh...")
+				if err := a.fetchFeeds(true); err != nil {
+					fmt.Printf("Auto-refresh error: %v\n", err)
+				}
 			}
 		}
 	}()
 	fmt.Printf("Auto-refresh started with interval: %v\n", interval)
 }
 
-// GetSources returns the list of feed sources
+// StopAutoRefresh stops the background refresh started by StartAutoRefresh
+func (a *Aggregator) StopAutoRefresh() {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	if a.refreshStop != nil {
+		close(a.refreshStop)
+		a.refreshStop, a.refreshInterval = nil, 0
+		fmt.Println("Auto-refresh stopped")
+	}
+}
+
+// GetSources returns a copy of the list of feed sources
 func (a *Aggregator) GetSources() []FeedSource {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-	return a.Sources
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]FeedSource(nil), a.Sources...)
 }
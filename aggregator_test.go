@@ -0,0 +1,101 @@
+package beam
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// tombstoneIDs returns the sorted IDs of the tombstones of the aggregated feed
+func tombstoneIDs(a *Aggregator) string {
+	var ids []string
+	for _, tombstone := range a.AggregatedFeed.Tombstones {
+		ids = append(ids, tombstone.ID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, " ")
+}
+
+func TestAggregatedFeedReportsDeletions(t *testing.T) {
+	feed := NewFeed("Source", "https://example.com/feed")
+	feed.Items = testEntries(3)
+	var data atomic.Value
+	encode := func() {
+		encoded, err := feed.Encode(FormatBEAM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data.Store(encoded)
+	}
+	encode()
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", FormatBEAM.ContentType())
+		w.Write(data.Load().([]byte))
+	}))
+	defer source.Close()
+
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	id, err := a.AddSource("Source", "", source.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.FetchAllFeeds()
+	before := *a.AggregatedFeed.LastUpdated
+
+	// The publisher deletes entry 2
+	feed.RemoveEntry("2")
+	encode()
+	a.FetchAllFeeds()
+	if ids := tombstoneIDs(a); ids != "2" {
+		t.Fatalf("tombstones after deletion = %q, want \"2\"", ids)
+	}
+	if deleted := a.AggregatedFeed.Tombstones[0].Deleted; !deleted.After(before) {
+		t.Fatalf("tombstone deleted at %s, not after the previous version at %s", deleted, before)
+	}
+
+	// A disabled source's entries are gone until it is enabled again
+	a.DisableSource(id)
+	a.FetchAllFeeds()
+	if ids := tombstoneIDs(a); ids != "0 1 2" {
+		t.Fatalf("tombstones after disabling = %q, want \"0 1 2\"", ids)
+	}
+	a.EnableSource(id)
+	a.FetchAllFeeds()
+	if ids := tombstoneIDs(a); ids != "2" || len(a.AggregatedFeed.Items) != 2 {
+		t.Fatalf("after enabling: %d entries, tombstones %q", len(a.AggregatedFeed.Items), ids)
+	}
+
+	// A removed source's entries are gone for good
+	a.RemoveSource(id)
+	a.FetchAllFeeds()
+	if ids := tombstoneIDs(a); ids != "0 1 2" || len(a.AggregatedFeed.Items) != 0 {
+		t.Fatalf("after removal: %d entries, tombstones %q", len(a.AggregatedFeed.Items), ids)
+	}
+}
+
+func TestUnchangedRefreshKeepsValidators(t *testing.T) {
+	source := newTestSource(t, 3)
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	if _, err := a.AddSource("Source", "", source.URL); err != nil {
+		t.Fatal(err)
+	}
+	a.FetchAllFeeds()
+	first := serveFeed(a.AggregatedFeed, http.MethodGet, "/feed", nil)
+
+	a.FetchAllFeeds()
+	rec := serveFeed(a.AggregatedFeed, http.MethodGet, "/feed", map[string]string{
+		"If-None-Match": first.Header().Get("ETag"),
+	})
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("If-None-Match after an unchanged refresh: status %d, want 304", rec.Code)
+	}
+	rec = serveFeed(a.AggregatedFeed, http.MethodGet, "/feed", map[string]string{
+		"If-Modified-Since": first.Header().Get("Last-Modified"),
+	})
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since after an unchanged refresh: status %d, want 304", rec.Code)
+	}
+}
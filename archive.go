@@ -0,0 +1,247 @@
+package beam
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// ArchiveCacheControl is the cache control header of archive pages.
+	// Their boundaries never move, but their entries may still be edited
+	// or deleted, so caches revalidate them after an hour.
+	ArchiveCacheControl = "public, max-age=3600"
+
+	// maxArchivePages bounds how many pages a history walk fetches
+	maxArchivePages = 1000
+)
+
+// SetArchivePageSize splits the feed into archive pages of size entries,
+// as RFC 5005 archived feeds. ServeHTTP then serves the newest size entries
+// as the current document, linking to the archive pages with prev-archive.
+// Entries fill the pages in the order they were added, so an entry never
+// moves to another page: entries added later go on later pages whatever
+// their publication date, and a removed entry leaves its tombstone in its
+// place. A size of 0 serves the whole feed in one document.
+func (f *Feed) SetArchivePageSize(size int) {
+	f.archivePageSize = max(size, 0)
+}
+
+// ArchivePageCount returns the number of complete archive pages
+func (f *Feed) ArchivePageCount() int {
+	if f.archivePageSize == 0 {
+		return 0
+	}
+	return len(f.archiveSlots()) / f.archivePageSize
+}
+
+// CurrentDocument returns a copy of the feed holding its newest entries,
+// linked to the most recent archive page
+func (f *Feed) CurrentDocument() *Feed {
+	doc := f.archiveView()
+	if f.archivePageSize == 0 {
+		doc.Items = f.Items
+		return doc
+	}
+
+	slots := f.archiveSlots()
+	doc.Items, _ = slotContents(slots[max(len(slots)-f.archivePageSize, 0):])
+	if pages := len(slots) / f.archivePageSize; pages > 0 {
+		doc.PrevArchiveURL = f.archivePageURL(pages)
+	}
+	return doc
+}
+
+// ArchivePage returns archive page n, counting from 1 for the oldest
+// entries, with the tombstones of the entries removed from it. Pages link
+// to their neighbours and to the current document.
+func (f *Feed) ArchivePage(n int) (*Feed, error) {
+	pages := f.ArchivePageCount()
+	if n < 1 || n > pages {
+		return nil, fmt.Errorf("%w: %d", ErrPageNotFound, n)
+	}
+
+	doc := f.archiveView()
+	doc.Items, doc.Tombstones = slotContents(f.archiveSlots()[(n-1)*f.archivePageSize : n*f.archivePageSize])
+	doc.Archive = true
+	doc.CurrentURL = f.FeedURL
+	if n > 1 {
+		doc.PrevArchiveURL = f.archivePageURL(n - 1)
+	}
+	if n < pages {
+		doc.NextArchiveURL = f.archivePageURL(n + 1)
+	}
+	return doc, nil
+}
+
+// archiveSlot is the place of an entry on the archive pages, holding the
+// entry or, once it was removed, its tombstone
+type archiveSlot struct {
+	seq       uint64
+	entry     *Entry
+	tombstone *Tombstone
+}
+
+// archiveSlots returns the places on the archive pages in order. Entries
+// that were not added through AddEntry or UpsertEntry, such as those of a
+// parsed feed, come first, oldest first; then come the entries added
+// through them and the tombstones of those removed, in order of addition.
+func (f *Feed) archiveSlots() []archiveSlot {
+	var unsequenced []Entry
+	var sequenced []archiveSlot
+	for i := range f.Items {
+		if f.Items[i].seq == 0 {
+			unsequenced = append(unsequenced, f.Items[i])
+		} else {
+			sequenced = append(sequenced, archiveSlot{seq: f.Items[i].seq, entry: &f.Items[i]})
+		}
+	}
+	for i := range f.Tombstones {
+		if f.Tombstones[i].seq != 0 {
+			sequenced = append(sequenced, archiveSlot{seq: f.Tombstones[i].seq, tombstone: &f.Tombstones[i]})
+		}
+	}
+	sort.Slice(sequenced, func(i, j int) bool {
+		return sequenced[i].seq < sequenced[j].seq
+	})
+
+	unsequenced = chronologicalItems(unsequenced)
+	slots := make([]archiveSlot, 0, len(unsequenced)+len(sequenced))
+	for i := range unsequenced {
+		slots = append(slots, archiveSlot{entry: &unsequenced[i]})
+	}
+	return append(slots, sequenced...)
+}
+
+// slotContents returns the entries and the tombstones of archive slots
+func slotContents(slots []archiveSlot) ([]Entry, []Tombstone) {
+	entries := make([]Entry, 0, len(slots))
+	var tombstones []Tombstone
+	for _, slot := range slots {
+		if slot.entry != nil {
+			entries = append(entries, *slot.entry)
+		} else {
+			tombstones = append(tombstones, *slot.tombstone)
+		}
+	}
+	return entries, tombstones
+}
+
+// archiveView returns a copy of the feed metadata without paging links
+func (f *Feed) archiveView() *Feed {
+	doc := *f
+	doc.NextURL, doc.PrevArchiveURL, doc.NextArchiveURL, doc.CurrentURL = "", "", "", ""
+	doc.Archive = false
+	doc.encoded = nil
+	return &doc
+}
+
+// archivePageURL returns the URL of archive page n
+func (f *Feed) archivePageURL(n int) string {
+	return withQuery(f.FeedURL, "page", strconv.Itoa(n))
+}
+
+// chronologicalItems returns the entries ordered oldest first
+func chronologicalItems(items []Entry) []Entry {
+	sorted := append([]Entry(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return entryBefore(sorted[j], sorted[i])
+	})
+	return sorted
+}
+
+// olderPageURL returns the link to the page of older entries of a feed
+// document: its previous archive page, or the next page of a paged feed
+func olderPageURL(f *Feed) string {
+	if f.PrevArchiveURL != "" {
+		return f.PrevArchiveURL
+	}
+	return f.NextURL
+}
+
+// FetchFeedHistory fetches a feed and walks its archive pages, or the
+// next pages of a paged feed, to collect its complete history. The walk
+// stops before any page for which seen returns true, so callers that
+// remember the archive pages they fetched only fetch new ones; seen may
+// be nil. It returns the current document with the entries of every page,
+// each entry ID once as it appears in the newest page, and the URLs of the
+// pages walked.
+func FetchFeedHistory(url string, seen func(pageURL string) bool) (*Feed, []string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	feed, err := fetchFeedPage(client, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	older, pages, err := walkFeedPages(client, feed, seen)
+	feed.Items = mergeEntries(feed.Items, older)
+	return feed, pages, err
+}
+
+// walkFeedPages follows the older-page links of a feed document and
+// returns the entries of the pages it fetched, newest pages first, and
+// their URLs. Entries collected before an error are returned with it.
+func walkFeedPages(client *http.Client, feed *Feed, seen func(pageURL string) bool) ([]Entry, []string, error) {
+	var entries []Entry
+	var pages []string
+	visited := make(map[string]bool)
+
+	for next := olderPageURL(feed); next != "" && len(pages) < maxArchivePages; {
+		if visited[next] || (seen != nil && seen(next)) {
+			break
+		}
+		visited[next] = true
+
+		page, err := fetchFeedPage(client, next)
+		if err != nil {
+			return entries, pages, fmt.Errorf("failed to fetch page %s: %w", next, err)
+		}
+		pages = append(pages, next)
+		entries = mergeEntries(entries, page.Items)
+		next = olderPageURL(page)
+	}
+	return entries, pages, nil
+}
+
+// fetchFeedPage fetches and parses one feed document
+func fetchFeedPage(client *http.Client, url string) (*Feed, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", feedAcceptHeader)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return ParseFeed(body, url)
+}
+
+// mergeEntries appends the entries of more whose IDs are not in entries
+func mergeEntries(entries, more []Entry) []Entry {
+	ids := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		ids[entry.ID] = true
+	}
+	for _, entry := range more {
+		if !ids[entry.ID] {
+			ids[entry.ID] = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,57 @@
+package beam
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// pageIDs returns the IDs of the entries and tombstones of archive page n
+func pageIDs(t *testing.T, f *Feed, n int) (string, string) {
+	t.Helper()
+	page, err := f.ArchivePage(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries, tombstones []string
+	for _, entry := range page.Items {
+		entries = append(entries, entry.ID)
+	}
+	for _, tombstone := range page.Tombstones {
+		tombstones = append(tombstones, tombstone.ID)
+	}
+	return strings.Join(entries, " "), strings.Join(tombstones, " ")
+}
+
+func TestArchivePageBoundariesAreStable(t *testing.T) {
+	f := NewFeed("Test", "https://example.com/feed")
+	f.SetArchivePageSize(2)
+	items := testEntries(5)
+	for i := len(items) - 1; i >= 0; i-- {
+		f.AddEntry(items[i])
+	}
+	if entries, _ := pageIDs(t, f, 1); entries != "4 3" {
+		t.Fatalf("page 1 = %q, want \"4 3\"", entries)
+	}
+
+	// A removed entry leaves its tombstone on its page
+	f.RemoveEntry("4")
+	if entries, tombstones := pageIDs(t, f, 1); entries != "3" || tombstones != "4" {
+		t.Fatalf("page 1 after removal = %q, tombstones %q", entries, tombstones)
+	}
+	if entries, _ := pageIDs(t, f, 2); entries != "2 1" {
+		t.Fatalf("page 2 after removal = %q, want \"2 1\"", entries)
+	}
+
+	// A backdated entry goes on the newest page
+	f.AddEntry(NewEntry("old", "Old", "https://example.com/old", time.Now().Add(-24*time.Hour)))
+	if entries, _ := pageIDs(t, f, 3); entries != "0 old" {
+		t.Fatalf("page 3 = %q, want \"0 old\"", entries)
+	}
+
+	// A restored entry returns to its place
+	f.UpsertEntry(items[4])
+	if entries, tombstones := pageIDs(t, f, 1); entries != "4 3" || tombstones != "" {
+		t.Fatalf("page 1 after restore = %q, tombstones %q", entries, tombstones)
+	}
+}
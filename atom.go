@@ -0,0 +1,253 @@
+package beam
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// atomFeed is the Atom feed document structure
+type atomFeed struct {
+	XMLName  xml.Name           `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string             `xml:"id"`
+	Title    string             `xml:"title"`
+	Subtitle string             `xml:"subtitle,omitempty"`
+	Updated  string             `xml:"updated"`
+	Links    []atomLink         `xml:"link"`
+	Archive  *struct{}          `xml:"http://purl.org/syndication/history/1.0 archive"`
+	Author   *atomPerson        `xml:"author,omitempty"`
+	Entries  []atomEntry        `xml:"entry"`
+	Deleted  []atomDeletedEntry `xml:"http://purl.org/atompub/tombstones/1.0 deleted-entry"`
+}
+
+// atomDeletedEntry is the tombstone of a deleted entry (RFC 6721)
+type atomDeletedEntry struct {
+	Ref  string `xml:"ref,attr"`
+	When string `xml:"when,attr"`
+}
+
+// atomLink is the Atom link element
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Title  string `xml:"title,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+// atomPerson is the Atom person construct
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+	URI   string `xml:"uri,omitempty"`
+}
+
+// atomText is an Atom text construct
+type atomText struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// atomCategory is the Atom category element
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// atomEntry is the Atom entry element.
+// Media precedes Content because Content would accept media:content too.
+type atomEntry struct {
+	ID         string          `xml:"id"`
+	Title      string          `xml:"title"`
+	Links      []atomLink      `xml:"link"`
+	Published  string          `xml:"published,omitempty"`
+	Updated    string          `xml:"updated"`
+	Author     *atomPerson     `xml:"author,omitempty"`
+	Summary    *atomText       `xml:"summary,omitempty"`
+	Media      []mediaContent  `xml:"http://search.yahoo.com/mrss/ content"`
+	Content    *atomText       `xml:"content,omitempty"`
+	Categories []atomCategory  `xml:"category"`
+	Thumbnail  *mediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+// ToAtom serializes the feed as an Atom document
+func (f *Feed) ToAtom() ([]byte, error) {
+	doc := atomFeed{
+		ID:       f.FeedURL,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Links:    []atomLink{{Href: f.FeedURL, Rel: "self", Type: "application/atom+xml"}},
+		Author:   atomAuthor(f.Author),
+		Entries:  make([]atomEntry, 0, len(f.Items)),
+	}
+	if f.HomePageURL != "" {
+		doc.Links = append(doc.Links, atomLink{Href: f.HomePageURL, Rel: "alternate", Type: "text/html"})
+	}
+	if f.Hub != "" {
+		doc.Links = append(doc.Links, atomLink{Href: f.Hub, Rel: "hub"})
+	}
+	doc.Links = append(doc.Links, f.pagingLinks("application/atom+xml")...)
+	if f.Archive {
+		doc.Archive = &struct{}{}
+	}
+	if f.LastUpdated != nil {
+		doc.Updated = f.LastUpdated.Format(time.RFC3339)
+	} else {
+		doc.Updated = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	for _, entry := range f.Items {
+		updated := entry.Published
+		if entry.Updated != nil {
+			updated = *entry.Updated
+		}
+
+		item := atomEntry{
+			ID:        entry.ID,
+			Title:     entry.Title,
+			Links:     []atomLink{{Href: entry.URL, Rel: "alternate", Type: "text/html"}},
+			Published: entry.Published.Format(time.RFC3339),
+			Updated:   updated.Format(time.RFC3339),
+			Author:    atomAuthor(entry.Author),
+		}
+		if entry.Summary != "" {
+			item.Summary = &atomText{Type: "text", Value: entry.Summary}
+		}
+		if entry.Content != "" {
+			item.Content = &atomText{Type: "html", Value: entry.Content}
+		}
+		for _, term := range entryTerms(entry) {
+			item.Categories = append(item.Categories, atomCategory{Term: term})
+		}
+		item.Links = append(item.Links, atomEnclosureLinks(entry.Attachments)...)
+		if media, thumbnail := mediaElements(entry); media != nil {
+			item.Media, item.Thumbnail = []mediaContent{*media}, thumbnail
+		}
+		doc.Entries = append(doc.Entries, item)
+	}
+	doc.Deleted = atomDeletedEntries(f.Tombstones)
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// atomAuthor converts a BEAM author to an Atom person construct
+func atomAuthor(author *Author) *atomPerson {
+	if author == nil || author.Name == "" {
+		return nil
+	}
+	return &atomPerson{Name: author.Name, Email: author.Email, URI: author.URL}
+}
+
+// fromAtom converts an Atom document into a BEAM feed.
+// Entries without a usable ID, URL or date are skipped.
+func fromAtom(data []byte) (*Feed, error) {
+	var doc atomFeed
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse Atom: %w", err)
+	}
+
+	feed := NewFeed(doc.Title, atomLinkHref(doc.Links, "self"))
+	feed.Description = doc.Subtitle
+	feed.HomePageURL = atomLinkHref(doc.Links, "alternate")
+	feed.Hub = atomLinkHref(doc.Links, "hub")
+	feed.setPagingLinks(doc.Links)
+	feed.Archive = doc.Archive != nil
+	if doc.Author != nil {
+		feed.Author = &Author{Name: doc.Author.Name, Email: doc.Author.Email, URL: doc.Author.URI}
+	}
+
+	for _, item := range doc.Entries {
+		published, _ := time.Parse(time.RFC3339, item.Published)
+		updated, _ := time.Parse(time.RFC3339, item.Updated)
+		if published.IsZero() {
+			published = updated
+		}
+
+		entry := NewEntry(item.ID, item.Title, atomLinkHref(item.Links, "alternate"), published)
+		if !updated.IsZero() && !updated.Equal(published) {
+			entry.SetUpdated(updated)
+		}
+		if item.Summary != nil {
+			entry.Summary = item.Summary.Value
+		}
+		if item.Content != nil {
+			entry.SetContent(item.Content.Value)
+		}
+		if item.Author != nil {
+			entry.Author = &Author{Name: item.Author.Name, Email: item.Author.Email, URL: item.Author.URI}
+		}
+		for _, category := range item.Categories {
+			entry.Tags = append(entry.Tags, category.Term)
+		}
+		fromMediaElements(&entry, item.Media, item.Thumbnail)
+		entry.Attachments = fromAtomEnclosureLinks(item.Links)
+		if entry.Validate() != nil {
+			continue
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+	feed.Tombstones = fromAtomDeletedEntries(doc.Deleted)
+
+	return feed, nil
+}
+
+// atomDeletedEntries converts tombstones to deleted-entry elements
+func atomDeletedEntries(tombstones []Tombstone) []atomDeletedEntry {
+	deleted := make([]atomDeletedEntry, 0, len(tombstones))
+	for _, tombstone := range tombstones {
+		deleted = append(deleted, atomDeletedEntry{Ref: tombstone.ID, When: tombstone.Deleted.Format(time.RFC3339)})
+	}
+	return deleted
+}
+
+// fromAtomDeletedEntries converts deleted-entry elements to tombstones.
+// Elements without a ref are skipped.
+func fromAtomDeletedEntries(deleted []atomDeletedEntry) []Tombstone {
+	var tombstones []Tombstone
+	for _, element := range deleted {
+		if element.Ref == "" {
+			continue
+		}
+		when, _ := time.Parse(time.RFC3339, element.When)
+		tombstones = append(tombstones, Tombstone{ID: element.Ref, Deleted: when})
+	}
+	return tombstones
+}
+
+// pagingLinks returns the Atom links to the next page and archive pages
+func (f *Feed) pagingLinks(mediaType string) []atomLink {
+	var links []atomLink
+	for _, link := range []struct{ rel, href string }{
+		{"next", f.NextURL},
+		{"prev-archive", f.PrevArchiveURL},
+		{"next-archive", f.NextArchiveURL},
+		{"current", f.CurrentURL},
+	} {
+		if link.href != "" {
+			links = append(links, atomLink{Href: link.href, Rel: link.rel, Type: mediaType})
+		}
+	}
+	return links
+}
+
+// setPagingLinks reads the next page and archive page links of a feed
+func (f *Feed) setPagingLinks(links []atomLink) {
+	f.NextURL = atomLinkHref(links, "next")
+	f.PrevArchiveURL = atomLinkHref(links, "prev-archive")
+	f.NextArchiveURL = atomLinkHref(links, "next-archive")
+	f.CurrentURL = atomLinkHref(links, "current")
+}
+
+// atomLinkHref returns the href of the first link with the given relation.
+// Links without a rel attribute count as "alternate".
+func atomLinkHref(links []atomLink, rel string) string {
+	for _, link := range links {
+		if link.Rel == rel || (link.Rel == "" && rel == "alternate") {
+			return link.Href
+		}
+	}
+	return ""
+}
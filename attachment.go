@@ -0,0 +1,193 @@
+package beam
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attachment is a file published with an entry, such as the audio of a
+// podcast episode. It reads and writes JSON as a JSON Feed attachment, with
+// the duration in seconds.
+type Attachment struct {
+	URL      string
+	MIMEType string
+	Title    string
+	Size     int64         // size in bytes, 0 if unknown
+	Duration time.Duration // playing time of audio and video, 0 if unknown
+}
+
+// attachmentJSON is the JSON form of an Attachment
+type attachmentJSON struct {
+	URL               string  `json:"url"`
+	MIMEType          string  `json:"mime_type"`
+	Title             string  `json:"title,omitempty"`
+	SizeInBytes       int64   `json:"size_in_bytes,omitempty"`
+	DurationInSeconds float64 `json:"duration_in_seconds,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(attachmentJSON{
+		URL:               a.URL,
+		MIMEType:          a.MIMEType,
+		Title:             a.Title,
+		SizeInBytes:       a.Size,
+		DurationInSeconds: a.Duration.Seconds(),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (a *Attachment) UnmarshalJSON(data []byte) error {
+	var v attachmentJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*a = Attachment{
+		URL:      v.URL,
+		MIMEType: v.MIMEType,
+		Title:    v.Title,
+		Size:     v.SizeInBytes,
+		Duration: time.Duration(v.DurationInSeconds * float64(time.Second)),
+	}
+	return nil
+}
+
+// Validate validates the attachment
+func (a Attachment) Validate() error {
+	if !isValidURL(a.URL) {
+		return NewError("attachments", "attachment url must be a valid URL")
+	}
+	if mediaType, _, err := mime.ParseMediaType(a.MIMEType); err != nil || !strings.Contains(mediaType, "/") {
+		return NewError("attachments", fmt.Sprintf("attachment %s must have a valid mime_type", a.URL))
+	}
+	if a.Size < 0 {
+		return NewError("attachments", fmt.Sprintf("attachment %s size must not be negative", a.URL))
+	}
+	if a.Duration < 0 {
+		return NewError("attachments", fmt.Sprintf("attachment %s duration must not be negative", a.URL))
+	}
+	return nil
+}
+
+// fileMIMEType guesses the MIME type of a file from the extension of its
+// URL, returning "" if the extension is not known
+func fileMIMEType(fileURL string) string {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(path.Ext(u.Path))))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// rssEnclosure is the RSS 2.0 enclosure element
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// rssEnclosures converts attachments to enclosure elements
+func rssEnclosures(attachments []Attachment) []rssEnclosure {
+	enclosures := make([]rssEnclosure, 0, len(attachments))
+	for _, attachment := range attachments {
+		enclosures = append(enclosures, rssEnclosure{URL: attachment.URL, Length: attachment.Size, Type: attachment.MIMEType})
+	}
+	return enclosures
+}
+
+// fromRSSEnclosures converts enclosure elements to attachments, with the
+// item's iTunes duration on the first one
+func fromRSSEnclosures(enclosures []rssEnclosure, duration string) []Attachment {
+	var attachments []Attachment
+	for _, enclosure := range enclosures {
+		attachment := Attachment{URL: enclosure.URL, MIMEType: enclosure.Type, Size: max(enclosure.Length, 0)}
+		if attachment.MIMEType == "" {
+			attachment.MIMEType = fileMIMEType(attachment.URL)
+		}
+		if len(attachments) == 0 {
+			attachment.Duration = parseITunesDuration(duration)
+		}
+		if attachment.Validate() != nil {
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments
+}
+
+// formatITunesDuration formats a duration as HH:MM:SS, or "" if it is 0
+func formatITunesDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	seconds := int64(math.Round(d.Seconds()))
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// parseITunesDuration parses an iTunes duration, given in seconds or as
+// [[HH:]MM:]SS, returning 0 if it is not valid
+func parseITunesDuration(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	var seconds float64
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// atomEnclosureLinks converts attachments to enclosure links
+func atomEnclosureLinks(attachments []Attachment) []atomLink {
+	links := make([]atomLink, 0, len(attachments))
+	for _, attachment := range attachments {
+		links = append(links, atomLink{
+			Href:   attachment.URL,
+			Rel:    "enclosure",
+			Type:   attachment.MIMEType,
+			Title:  attachment.Title,
+			Length: attachment.Size,
+		})
+	}
+	return links
+}
+
+// fromAtomEnclosureLinks converts the enclosure links of an entry to
+// attachments
+func fromAtomEnclosureLinks(links []atomLink) []Attachment {
+	var attachments []Attachment
+	for _, link := range links {
+		if link.Rel != "enclosure" {
+			continue
+		}
+		attachment := Attachment{URL: link.Href, MIMEType: link.Type, Title: link.Title, Size: max(link.Length, 0)}
+		if attachment.MIMEType == "" {
+			attachment.MIMEType = fileMIMEType(attachment.URL)
+		}
+		if attachment.Validate() != nil {
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments
+}
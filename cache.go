@@ -0,0 +1,170 @@
+package beam
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Content codings ServeHTTP can compress documents with
+const (
+	codingGzip    = "gzip"
+	codingDeflate = "deflate"
+)
+
+// docKey identifies an encoded document of a feed version
+type docKey struct {
+	format  Format
+	page    int    // archive page, 0 for the current document
+	compact bool   // whether JSON is encoded without indentation
+	coding  string // content coding, empty for none
+}
+
+// encodedCache holds the encoded documents of the latest version of a
+// feed that were requested, so serving a feed does not encode it again
+// for every request
+type encodedCache struct {
+	mu      sync.Mutex
+	version string
+	docs    map[docKey][]byte
+}
+
+// get returns the cached document of a feed version, encoding it on first
+// use. Documents of other versions are discarded.
+func (c *encodedCache) get(version string, key docKey, encode func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.version != version || c.docs == nil {
+		c.version = version
+		c.docs = make(map[docKey][]byte)
+	}
+	if data, ok := c.docs[key]; ok {
+		return data, nil
+	}
+	data, err := encode()
+	if err != nil {
+		return nil, err
+	}
+	c.docs[key] = data
+	return data, nil
+}
+
+// version identifies the state of a feed for caching. Every method that
+// changes the feed's entries updates LastUpdated.
+func (f *Feed) version() string {
+	var updated int64
+	if f.LastUpdated != nil {
+		updated = f.LastUpdated.UnixNano()
+	}
+	return fmt.Sprintf("%d-%d-%d", updated, len(f.Items), len(f.Tombstones))
+}
+
+// encodeDocument encodes the feed as described by key
+func (f *Feed) encodeDocument(key docKey) ([]byte, error) {
+	data, err := f.Encode(key.format)
+	if err != nil {
+		return nil, err
+	}
+	if key.compact && (key.format == FormatBEAM || key.format == FormatJSONFeed) {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, data); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+	return compress(data, key.coding)
+}
+
+// compress applies a content coding to data
+func compress(data []byte, coding string) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "":
+		return data, nil
+	case codingGzip:
+		w = gzip.NewWriter(&buf)
+	case codingDeflate:
+		// HTTP's deflate coding is the zlib format (RFC 9110, section 8.4.1.2)
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported content coding: %s", coding)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// negotiateCoding selects the content coding for an Accept-Encoding
+// header: gzip or deflate, whichever has the higher weight, preferring
+// gzip. It returns the empty string for an uncompressed response.
+func negotiateCoding(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		weights[coding] = q
+	}
+
+	weight := func(coding string) float64 {
+		if q, ok := weights[coding]; ok {
+			return q
+		}
+		return weights["*"]
+	}
+	best, bestWeight := "", 0.0
+	for _, coding := range []string{codingGzip, codingDeflate} {
+		if q := weight(coding); q > bestWeight {
+			best, bestWeight = coding, q
+		}
+	}
+	return best
+}
+
+// notModified evaluates the conditional headers of a request for a
+// document with the given entity tag and modification time. As in RFC 9110,
+// If-Modified-Since is ignored when If-None-Match is present.
+func notModified(r *http.Request, etag string, lastModified *time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified == nil {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	// Last-Modified is sent with one-second resolution
+	return !lastModified.Truncate(time.Second).After(since)
+}
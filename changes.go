@@ -0,0 +1,136 @@
+package beam
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FieldChange describes a field of an entry that changed between fetches
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// EntryUpdate lists the changed fields of an updated entry
+type EntryUpdate struct {
+	ID      string        `json:"id"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Changeset describes how a source feed changed in one refresh.
+// New holds entries never seen before, Updated holds entries whose fields
+// changed, and Removed holds entries that dropped out of the source feed
+// or were deleted by its publisher.
+// Initial is set for the first fetch of a source, where every entry is new.
+// Backfilled holds older entries found on the archive pages of the feed.
+type Changeset struct {
+	SourceID   string        `json:"source_id"`
+	FetchedAt  time.Time     `json:"fetched_at"`
+	Initial    bool          `json:"initial,omitempty"`
+	New        []string      `json:"new,omitempty"`
+	Backfilled []string      `json:"backfilled,omitempty"`
+	Updated    []EntryUpdate `json:"updated,omitempty"`
+	Removed    []string      `json:"removed,omitempty"`
+
+	// retracted holds the deleted entries, which are gone from the history
+	retracted map[string]Entry
+}
+
+// addRetracted reports entries dropped from the history for a tombstone
+// as removed
+func (c *Changeset) addRetracted(records []EntryRecord) {
+	if len(records) == 0 {
+		return
+	}
+	c.retracted = make(map[string]Entry, len(records))
+	for _, record := range records {
+		c.retracted[record.Entry.ID] = record.Entry
+		c.Removed = append(c.Removed, record.Entry.ID)
+	}
+	sort.Strings(c.Removed)
+}
+
+// IsEmpty reports whether the refresh changed nothing
+func (c Changeset) IsEmpty() bool {
+	return len(c.New) == 0 && len(c.Backfilled) == 0 && len(c.Updated) == 0 && len(c.Removed) == 0
+}
+
+// diffEntries returns the fields that differ between two versions of an
+// entry. Extensions are not compared, as they mostly carry counters such
+// as views and likes that change on every fetch.
+func diffEntries(old, new Entry) []FieldChange {
+	var changes []FieldChange
+	compare := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			changes = append(changes, FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+
+	compare("title", old.Title, new.Title)
+	compare("content", old.Content, new.Content)
+	compare("summary", old.Summary, new.Summary)
+	compare("url", old.URL, new.URL)
+	compare("published", formatChangeTime(&old.Published), formatChangeTime(&new.Published))
+	compare("updated", formatChangeTime(old.Updated), formatChangeTime(new.Updated))
+	compare("author", formatChangeAuthor(old.Author), formatChangeAuthor(new.Author))
+	compare("tags", strings.Join(old.Tags, ", "), strings.Join(new.Tags, ", "))
+	compare("category", old.Category, new.Category)
+	compare("image", old.Image, new.Image)
+	return changes
+}
+
+// formatChangeTime formats an optional timestamp for a field change
+func formatChangeTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatChangeAuthor formats an optional author for a field change
+func formatChangeAuthor(author *Author) string {
+	if author == nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Join([]string{author.Name, author.Email, author.URL}, " "))
+}
+
+// changeHooks holds the callbacks registered with OnChange
+type changeHooks struct {
+	mu    sync.RWMutex
+	hooks []func(Changeset)
+}
+
+// OnChange registers a callback invoked with the changeset of every source
+// that changed in a refresh. Callbacks run synchronously, in registration
+// order, after the aggregated feed has been rebuilt and without holding
+// the aggregator's lock, so they may call back into the aggregator.
+func (a *Aggregator) OnChange(fn func(Changeset)) {
+	a.changeHooks.mu.Lock()
+	defer a.changeHooks.mu.Unlock()
+	a.changeHooks.hooks = append(a.changeHooks.hooks, fn)
+}
+
+// LastChanges returns the changesets of the most recent refresh, one per
+// source that was fetched with changes
+func (a *Aggregator) LastChanges() []Changeset {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Changeset(nil), a.lastChanges...)
+}
+
+// notifyChanges runs the OnChange callbacks for each changeset
+func (a *Aggregator) notifyChanges(changesets []Changeset) {
+	a.changeHooks.mu.RLock()
+	hooks := a.changeHooks.hooks
+	a.changeHooks.mu.RUnlock()
+
+	for _, changeset := range changesets {
+		for _, hook := range hooks {
+			hook(changeset)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package beam
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestSource serves a feed of n entries without validators, so every
+// fetch receives the whole document
+func newTestSource(t *testing.T, n int) *httptest.Server {
+	t.Helper()
+	feed := NewFeed("Source", "https://example.com/feed")
+	feed.Items = testEntries(n)
+	data, err := feed.Encode(FormatBEAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", FormatBEAM.ContentType())
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRefreshReportsOnlyNewEntries(t *testing.T) {
+	source := newTestSource(t, 5)
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	a.SetRetentionPolicy(RetentionPolicy{MaxPerSource: 3})
+	if _, err := a.AddSource("Source", "", source.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.FetchAllFeeds(); err != nil {
+		t.Fatal(err)
+	}
+	changes := a.LastChanges()
+	if len(changes) != 1 || !changes[0].Initial || len(changes[0].New) != 5 {
+		t.Fatalf("first refresh changes = %+v, want 5 initial entries", changes)
+	}
+
+	var reported []Changeset
+	a.OnChange(func(c Changeset) { reported = append(reported, c) })
+	if err := a.FetchAllFeeds(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range a.LastChanges() {
+		if len(c.New) > 0 {
+			t.Fatalf("second refresh reported new entries %v", c.New)
+		}
+	}
+	if len(reported) != 0 {
+		t.Fatalf("OnChange called with %+v for an unchanged feed", reported)
+	}
+}
@@ -0,0 +1,360 @@
+package beam
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that reads and writes JSON as a string such as "5m"
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Config is the declarative configuration of an aggregator
+type Config struct {
+	Title     string          `json:"title"`
+	FeedURL   string          `json:"feed_url"`
+	Language  string          `json:"language,omitempty"`
+	Refresh   RefreshConfig   `json:"refresh"`
+	Limits    LimitsConfig    `json:"limits"`
+	Retention RetentionConfig `json:"retention"`
+	Filters   EntryFilter     `json:"filters"`
+	Sources   []SourceConfig  `json:"sources"`
+}
+
+// RefreshConfig controls how often and how patiently sources are fetched.
+// A zero interval disables automatic refresh.
+type RefreshConfig struct {
+	Interval     Duration `json:"interval"`
+	FetchTimeout Duration `json:"fetch_timeout"`
+}
+
+// LimitsConfig bounds the size of the aggregated feed
+type LimitsConfig struct {
+	MaxEntries int `json:"max_entries"`
+}
+
+// RetentionConfig bounds the entry history, see RetentionPolicy.
+// Zero values mean no limit.
+type RetentionConfig struct {
+	MaxAge       Duration `json:"max_age"`
+	MaxPerSource int      `json:"max_per_source"`
+	MaxEntries   int      `json:"max_entries"`
+}
+
+// SourceConfig declares one source of the aggregator
+type SourceConfig struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Description string   `json:"description,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Disabled    bool     `json:"disabled,omitempty"`
+}
+
+// LoadConfig reads and validates an aggregator configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig parses and validates an aggregator configuration.
+// Unknown fields are rejected so that typos do not go unnoticed.
+func ParseConfig(data []byte) (*Config, error) {
+	var cfg Config
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks the configuration and reports every problem found
+func (c *Config) Validate() error {
+	var errs []error
+
+	if strings.TrimSpace(c.Title) == "" {
+		errs = append(errs, NewError("title", "title is required"))
+	}
+	if !isValidURL(c.FeedURL) {
+		errs = append(errs, NewError("feed_url", "feed_url must be a valid URL"))
+	}
+	if c.Refresh.Interval.Duration < 0 {
+		errs = append(errs, NewError("refresh.interval", "interval must not be negative"))
+	} else if c.Refresh.Interval.Duration > 0 && c.Refresh.Interval.Duration < time.Second {
+		errs = append(errs, NewError("refresh.interval", "interval must be at least 1s"))
+	}
+	if c.Refresh.FetchTimeout.Duration < 0 {
+		errs = append(errs, NewError("refresh.fetch_timeout", "fetch_timeout must not be negative"))
+	}
+	if c.Limits.MaxEntries < 0 {
+		errs = append(errs, NewError("limits.max_entries", "max_entries must not be negative"))
+	}
+	if c.Retention.MaxAge.Duration < 0 {
+		errs = append(errs, NewError("retention.max_age", "max_age must not be negative"))
+	}
+	if c.Retention.MaxPerSource < 0 {
+		errs = append(errs, NewError("retention.max_per_source", "max_per_source must not be negative"))
+	}
+	if c.Retention.MaxEntries < 0 {
+		errs = append(errs, NewError("retention.max_entries", "max_entries must not be negative"))
+	}
+
+	seen := make(map[string]int)
+	for i, src := range c.Sources {
+		field := fmt.Sprintf("sources[%d]", i)
+		if strings.TrimSpace(src.Name) == "" {
+			errs = append(errs, NewError(field+".name", "name is required"))
+		}
+		if !isValidURL(src.URL) {
+			errs = append(errs, NewError(field+".url", "url must be a valid URL"))
+			continue
+		}
+		key := normalizeSourceURL(src.URL)
+		if j, ok := seen[key]; ok {
+			errs = append(errs, NewError(field+".url", fmt.Sprintf("duplicate of sources[%d]", j)))
+			continue
+		}
+		seen[key] = i
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewAggregatorFromConfig creates an aggregator as described by cfg
+func NewAggregatorFromConfig(cfg *Config) (*Aggregator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	a := NewAggregator(cfg.Title, cfg.FeedURL)
+	if err := a.ApplyConfig(cfg); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// ApplyConfig reconciles the running aggregator with cfg. Sources are
+// matched by URL: new ones are added, listed ones are updated in place
+// (keeping their ID and fetch state) and unlisted ones are removed.
+// The aggregated feed is rebuilt with the new settings right away.
+// Automatic refresh is started, restarted or stopped to match the
+// configured interval. An invalid config is rejected without changes.
+func (a *Aggregator) ApplyConfig(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	a.mu.Lock()
+	if a.AggregatedFeed.Title != cfg.Title || a.AggregatedFeed.FeedURL != cfg.FeedURL {
+		a.AggregatedFeed.Title, a.AggregatedFeed.FeedURL = cfg.Title, cfg.FeedURL
+		a.AggregatedFeed.markChanged()
+	}
+	a.language = "en-US"
+	if cfg.Language != "" {
+		a.language = cfg.Language
+	}
+	a.fetchTimeout = 30 * time.Second
+	if cfg.Refresh.FetchTimeout.Duration > 0 {
+		a.fetchTimeout = cfg.Refresh.FetchTimeout.Duration
+	}
+	a.maxEntries = 100
+	if cfg.Limits.MaxEntries > 0 {
+		a.maxEntries = cfg.Limits.MaxEntries
+	}
+	a.filter = cfg.Filters
+
+	previous := make(map[string]FeedSource, len(a.Sources))
+	for _, src := range a.Sources {
+		previous[src.ID] = src
+	}
+	a.retention = RetentionPolicy{
+		MaxAge:       cfg.Retention.MaxAge.Duration,
+		MaxPerSource: cfg.Retention.MaxPerSource,
+		MaxEntries:   cfg.Retention.MaxEntries,
+	}
+
+	sources := make([]FeedSource, 0, len(cfg.Sources))
+	for _, sc := range cfg.Sources {
+		// Existing sources keep their URL, which may be a feed discovered
+		// from the configured home page
+		src := FeedSource{URL: sc.URL, Status: "new"}
+		if existing := a.findSourceByURLLocked(sc.URL); existing != nil {
+			src = *existing
+		}
+		src.Name = sc.Name
+		src.Description = sc.Description
+		src.Group = strings.Trim(sc.Group, "/")
+		src.Tags = append([]string(nil), sc.Tags...)
+		if sc.Disabled {
+			src.Disabled, src.Status = true, "disabled"
+		} else if src.Disabled {
+			src.Disabled, src.Status = false, "new"
+		}
+		sources = append(sources, src)
+	}
+
+	// Rebuild the source list so that unlisted sources are dropped and
+	// new ones receive fresh IDs that do not collide with kept ones
+	a.Sources = make([]FeedSource, 0, len(sources))
+	for _, src := range sources {
+		if src.ID != "" {
+			a.Sources = append(a.Sources, src)
+		}
+	}
+	for i := range sources {
+		if sources[i].ID != "" {
+			continue
+		}
+		id, err := a.addSourceLocked(sources[i])
+		if err != nil {
+			fmt.Printf("Skipped source %s: %v\n", sources[i].Name, err)
+			continue
+		}
+		sources[i].ID = id
+	}
+
+	// Keep the order of the config file
+	ordered := make([]FeedSource, 0, len(a.Sources))
+	for _, src := range sources {
+		if i := a.sourceIndexLocked(src.ID); src.ID != "" && i >= 0 {
+			ordered = append(ordered, a.Sources[i])
+		}
+	}
+	a.Sources = ordered
+	for id := range a.history.records {
+		if a.sourceIndexLocked(id) < 0 {
+			a.history.removeSource(id)
+		}
+	}
+	for id := range a.websub.subs {
+		if a.sourceIndexLocked(id) < 0 {
+			a.unsubscribeLocked(id)
+		}
+	}
+
+	// The title, language, limits, filter and sources shape the aggregated
+	// feed, which is rebuilt as a new version so no stale document is served
+	a.rebuildLocked()
+	a.persistLocked()
+
+	for _, src := range a.Sources {
+		old, ok := previous[src.ID]
+		switch {
+		case !ok:
+			a.publishSourceEvent(EventSourceAdded, src, nil)
+		case sourceMetadataChanged(old, src):
+			a.publishSourceEvent(EventSourceUpdated, src, nil)
+		}
+		delete(previous, src.ID)
+	}
+	for _, src := range previous {
+		a.publishSourceEvent(EventSourceRemoved, src, nil)
+	}
+	a.mu.Unlock()
+
+	a.refreshMu.Lock()
+	interval, running := a.refreshInterval, a.refreshStop != nil
+	a.refreshMu.Unlock()
+
+	switch {
+	case cfg.Refresh.Interval.Duration == 0 && running:
+		a.StopAutoRefresh()
+	case cfg.Refresh.Interval.Duration > 0 && cfg.Refresh.Interval.Duration != interval:
+		a.StartAutoRefresh(cfg.Refresh.Interval.Duration)
+	}
+
+	fmt.Printf("Applied config with %d sources\n", len(cfg.Sources))
+	return nil
+}
+
+// WatchConfig polls the configuration file at path and applies it whenever
+// its contents change, fetching all sources once it is applied. A config
+// that fails to load or validate is reported and ignored, leaving the
+// running configuration in place. The returned function stops watching.
+func (a *Aggregator) WatchConfig(path string, interval time.Duration) func() {
+	var lastSum [sha256.Size]byte
+	if data, err := os.ReadFile(path); err == nil {
+		lastSum = sha256.Sum256(data)
+	}
+
+	stop := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Printf("Config reload failed: %v\n", err)
+				continue
+			}
+			sum := sha256.Sum256(data)
+			if sum == lastSum {
+				continue
+			}
+			lastSum = sum
+
+			cfg, err := ParseConfig(data)
+			if err == nil {
+				err = a.ApplyConfig(cfg)
+			}
+			if err != nil {
+				fmt.Printf("Config reload rejected, keeping running config: %v\n", err)
+				continue
+			}
+
+			if err := a.FetchAllFeeds(); err != nil {
+				fmt.Printf("Fetch after config reload failed: %v\n", err)
+			}
+		}
+	}()
+
+	fmt.Printf("Watching config file: %s\n", path)
+	return func() { close(stop) }
+}
+
+// sourceMetadataChanged reports whether a config reload changed a source
+func sourceMetadataChanged(old, new FeedSource) bool {
+	return old.URL != new.URL || old.Name != new.Name || old.Description != new.Description ||
+		old.Group != new.Group || old.Disabled != new.Disabled ||
+		strings.Join(old.Tags, "\x00") != strings.Join(new.Tags, "\x00")
+}
@@ -0,0 +1,27 @@
+package beam
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApplyConfigServesNewTitle(t *testing.T) {
+	a := NewAggregator("Old title", "https://example.com/aggregated")
+	serve := func() string {
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Body.String()
+	}
+	if body := serve(); !strings.Contains(body, "Old title") {
+		t.Fatalf("feed does not have the old title: %s", body)
+	}
+
+	err := a.ApplyConfig(&Config{Title: "New title", FeedURL: "https://example.com/aggregated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := serve(); !strings.Contains(body, "New title") {
+		t.Fatalf("feed still served with the old title: %s", body)
+	}
+}
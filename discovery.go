@@ -0,0 +1,241 @@
+package beam
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// feedAcceptHeader is sent when fetching feeds so that negotiating
+// publishers prefer BEAM, then the other feed formats
+const feedAcceptHeader = "application/beam+json, application/feed+json;q=0.9, application/atom+xml;q=0.8, application/rss+xml;q=0.8, application/json;q=0.7, application/xml;q=0.5, */*;q=0.1"
+
+// Candidate origins reported by DiscoverFeeds
+const (
+	// OriginLink marks a candidate declared by a <link rel="alternate"> tag
+	OriginLink = "link"
+	// OriginWellKnown marks a candidate found by probing a well-known path
+	OriginWellKnown = "well-known"
+)
+
+// FeedCandidate is a feed found while discovering feeds for a web page
+type FeedCandidate struct {
+	URL    string `json:"url"`
+	Format Format `json:"format"`
+	Title  string `json:"title,omitempty"`
+	Origin string `json:"origin"`
+}
+
+// wellKnownFeedPaths are probed when a page does not declare any feeds
+var wellKnownFeedPaths = []string{"/feed.json", "/feed", "/atom.xml", "/rss.xml", "/feed.xml", "/index.xml"}
+
+// formatRank orders candidate formats from most to least preferred
+var formatRank = map[Format]int{
+	FormatBEAM:     0,
+	FormatJSONFeed: 1,
+	FormatAtom:     2,
+	FormatRSS:      3,
+}
+
+var (
+	linkTagPattern   = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	attributePattern = regexp.MustCompile(`(?s)([a-zA-Z_:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// DiscoverFeeds finds the feeds published by the web page at pageURL.
+// It reads the page's <link rel="alternate"> tags for BEAM, JSON Feed, RSS
+// and Atom feeds; if none are declared it probes well-known feed paths on the
+// same host. Candidates are ranked BEAM first, then JSON Feed, Atom and RSS.
+func DiscoverFeeds(pageURL string) ([]FeedCandidate, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	candidates := discoverFeeds(client, resp.Request.URL.String(), body)
+	if len(candidates) == 0 {
+		return nil, ErrNoFeedFound
+	}
+	return candidates, nil
+}
+
+// discoverFeeds extracts ranked feed candidates from an already fetched page
+func discoverFeeds(client *http.Client, pageURL string, page []byte) []FeedCandidate {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	candidates := parseAlternateLinks(base, string(page))
+	if len(candidates) == 0 {
+		candidates = probeWellKnownFeeds(client, base)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return formatRank[candidates[i].Format] < formatRank[candidates[j].Format]
+	})
+	return candidates
+}
+
+// parseAlternateLinks returns the feeds declared by <link rel="alternate"> tags
+func parseAlternateLinks(base *url.URL, page string) []FeedCandidate {
+	var candidates []FeedCandidate
+	seen := make(map[string]bool)
+
+	for _, tag := range linkTagPattern.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, match := range attributePattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(match[1])] = html.UnescapeString(match[2] + match[3] + match[4])
+		}
+
+		if !hasToken(attrs["rel"], "alternate") || attrs["href"] == "" {
+			continue
+		}
+
+		mediaType, _, err := mime.ParseMediaType(attrs["type"])
+		if err != nil {
+			continue
+		}
+		format, ok := mediaTypeFormats[strings.ToLower(mediaType)]
+		if !ok || format == FormatHTML {
+			continue
+		}
+
+		href, err := base.Parse(strings.TrimSpace(attrs["href"]))
+		if err != nil || (href.Scheme != "http" && href.Scheme != "https") {
+			continue
+		}
+		if seen[href.String()] {
+			continue
+		}
+		seen[href.String()] = true
+
+		candidates = append(candidates, FeedCandidate{
+			URL:    href.String(),
+			Format: format,
+			Title:  attrs["title"],
+			Origin: OriginLink,
+		})
+	}
+
+	return candidates
+}
+
+// probeWellKnownFeeds requests well-known feed paths on the page's host
+func probeWellKnownFeeds(client *http.Client, base *url.URL) []FeedCandidate {
+	var candidates []FeedCandidate
+	for _, path := range wellKnownFeedPaths {
+		probe := &url.URL{Scheme: base.Scheme, Host: base.Host, Path: path}
+
+		req, err := http.NewRequest(http.MethodGet, probe.String(), nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Accept", feedAcceptHeader)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if err != nil {
+			continue
+		}
+		format, ok := mediaTypeFormats[strings.ToLower(mediaType)]
+		if !ok || format == FormatHTML {
+			continue
+		}
+
+		candidates = append(candidates, FeedCandidate{
+			URL:    probe.String(),
+			Format: format,
+			Origin: OriginWellKnown,
+		})
+	}
+	return candidates
+}
+
+// hasToken reports whether the space separated list contains token
+func hasToken(list, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTMLResponse reports whether resp carries an HTML page rather than a feed
+func isHTMLResponse(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// AlternateLinks returns the <link rel="alternate"> tags advertising the
+// feed in every supported format, plus the feed's WebSub hub, for inclusion
+// in an HTML page's <head>
+func (f *Feed) AlternateLinks() string {
+	if f.FeedURL == "" {
+		return ""
+	}
+
+	links := []struct {
+		mediaType string
+		format    Format
+		label     string
+	}{
+		{MediaTypeBEAM, FormatBEAM, "BEAM"},
+		{"application/feed+json", FormatJSONFeed, "JSON Feed"},
+		{"application/atom+xml", FormatAtom, "Atom"},
+		{"application/rss+xml", FormatRSS, "RSS"},
+	}
+
+	var b strings.Builder
+	for _, link := range links {
+		href := f.FeedURL
+		if link.format != FormatBEAM {
+			href = withQuery(f.FeedURL, "format", string(link.format))
+		}
+		fmt.Fprintf(&b, `<link rel="alternate" type="%s" title="%s" href="%s">`+"\n",
+			link.mediaType, html.EscapeString(f.Title+" ("+link.label+")"), html.EscapeString(href))
+	}
+	if f.Hub != "" {
+		fmt.Fprintf(&b, `<link rel="hub" href="%s">`+"\n", html.EscapeString(f.Hub))
+	}
+	return b.String()
+}
+
+// withQuery returns rawURL with the query parameter key set to value
+func withQuery(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
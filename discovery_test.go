@@ -0,0 +1,25 @@
+package beam
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAlternateLinkTypesMatchContentNegotiation(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	page := `<link rel="alternate" type="application/json" href="/feed">
+<link rel="alternate" type="application/feed+json" href="/feed.json">
+<link rel="alternate" type="text/html" href="/index.html">`
+
+	candidates := parseAlternateLinks(base, page)
+	if len(candidates) != 2 {
+		t.Fatalf("got %d candidates, want 2: %+v", len(candidates), candidates)
+	}
+	for _, candidate := range candidates {
+		u, _ := url.Parse(candidate.URL)
+		mediaType := map[string]string{"/feed": "application/json", "/feed.json": "application/feed+json"}[u.Path]
+		if want := mediaTypeFormats[mediaType]; candidate.Format != want {
+			t.Errorf("%s link discovered as %s, negotiated as %s", mediaType, candidate.Format, want)
+		}
+	}
+}
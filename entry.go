@@ -18,8 +18,13 @@ type Entry struct {
 	Tags        []string        `json:"tags,omitempty"`
 	Category    string          `json:"category,omitempty"`
 	Image       string          `json:"image,omitempty"`
+	ImageInfo   *ImageInfo      `json:"image_info,omitempty"`
+	Attachments []Attachment    `json:"attachments,omitempty"`
 	ReadingTime int             `json:"reading_time,omitempty"`
 	Extensions  ExtensionFields `json:"extensions,omitempty"`
+
+	changed time.Time // when the entry was last added to or replaced in its feed, for deltas
+	seq     uint64    // order in which the entry was added to its feed, for archive pages
 }
 
 // NewEntry creates a new entry with required fields
@@ -38,9 +43,75 @@ func (e *Entry) SetAuthor(name, email, url string) {
 	e.Author = &Author{Name: name, Email: email, URL: url}
 }
 
+// ContentOption configures how SetContent processes content
+type ContentOption func(*contentOptions)
+
+// contentOptions holds the options of a SetContent call
+type contentOptions struct {
+	sanitize      *SanitizePolicy
+	excerptLength int
+	readingTime   *ReadingTimeEstimator
+	extractImage  bool
+}
+
+// WithSanitizer sanitizes the content with a policy, resolving relative
+// links against the entry URL
+func WithSanitizer(policy SanitizePolicy) ContentOption {
+	return func(o *contentOptions) {
+		o.sanitize = &policy
+	}
+}
+
+// WithExcerpt sets the summary of an entry without one to an excerpt of
+// the content of at most maxLength characters, see Excerpt. A maxLength of
+// 0 or less uses DefaultExcerptLength.
+func WithExcerpt(maxLength int) ContentOption {
+	return func(o *contentOptions) {
+		o.excerptLength = DefaultExcerptLength
+		if maxLength > 0 {
+			o.excerptLength = maxLength
+		}
+	}
+}
+
+// WithReadingTime calculates the reading time with an estimator instead of
+// CalculateReadingTime
+func WithReadingTime(estimator ReadingTimeEstimator) ContentOption {
+	return func(o *contentOptions) {
+		o.readingTime = &estimator
+	}
+}
+
+// WithImageExtraction sets the featured image of an entry without one to
+// the first meaningful image of the content, see ExtractImage
+func WithImageExtraction() ContentOption {
+	return func(o *contentOptions) {
+		o.extractImage = true
+	}
+}
+
 // SetContent sets the entry content and automatically calculates reading time
-func (e *Entry) SetContent(content string) {
-	e.Content, e.ReadingTime = content, CalculateReadingTime(content)
+func (e *Entry) SetContent(content string, options ...ContentOption) {
+	var opts contentOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.sanitize != nil {
+		content = opts.sanitize.Sanitize(content, e.URL)
+	}
+	if opts.readingTime != nil {
+		e.Content, e.ReadingTime = content, opts.readingTime.Minutes(content)
+	} else {
+		e.Content, e.ReadingTime = content, CalculateReadingTime(content)
+	}
+	if opts.excerptLength > 0 && e.Summary == "" {
+		e.Summary = Excerpt(content, opts.excerptLength)
+	}
+	if opts.extractImage && e.Image == "" {
+		if info, ok := ExtractImage(content, e.URL); ok {
+			e.SetImageInfo(info)
+		}
+	}
 }
 
 // SetSummary sets the entry summary
@@ -58,9 +129,43 @@ func (e *Entry) SetCategory(category string) {
 	e.Category = category
 }
 
-// SetImage sets the entry featured image
+// SetImage sets the entry featured image, dropping the metadata of any
+// previous image
 func (e *Entry) SetImage(imageURL string) {
 	e.Image = imageURL
+	if e.ImageInfo != nil && e.ImageInfo.URL != imageURL {
+		e.ImageInfo = nil
+	}
+}
+
+// SetImageInfo sets the entry featured image with its metadata. The MIME
+// type is guessed from the URL if it is not set.
+func (e *Entry) SetImageInfo(info ImageInfo) {
+	if info.MIMEType == "" {
+		info.MIMEType = imageMIMEType(info.URL)
+	}
+	e.Image, e.ImageInfo = info.URL, &info
+}
+
+// FeaturedImage returns the entry featured image with whatever metadata
+// is known about it
+func (e Entry) FeaturedImage() (ImageInfo, bool) {
+	if e.ImageInfo != nil && (e.Image == "" || e.ImageInfo.URL == e.Image) {
+		return *e.ImageInfo, true
+	}
+	if e.Image == "" {
+		return ImageInfo{}, false
+	}
+	return ImageInfo{URL: e.Image, MIMEType: imageMIMEType(e.Image)}, true
+}
+
+// AddAttachment adds a file to the entry. The MIME type is guessed from
+// the URL if it is not set.
+func (e *Entry) AddAttachment(attachment Attachment) {
+	if attachment.MIMEType == "" {
+		attachment.MIMEType = fileMIMEType(attachment.URL)
+	}
+	e.Attachments = append(e.Attachments, attachment)
 }
 
 // SetUpdated sets the entry updated timestamp
@@ -101,5 +206,20 @@ func (e *Entry) Validate() error {
 		return NewError("image", "image must be a valid URL")
 	}
 
+	if e.ImageInfo != nil {
+		if !isValidURL(e.ImageInfo.URL) {
+			return NewError("image_info", "image_info url must be a valid URL")
+		}
+		if e.ImageInfo.Width < 0 || e.ImageInfo.Height < 0 {
+			return NewError("image_info", "image_info width and height must not be negative")
+		}
+	}
+
+	for _, attachment := range e.Attachments {
+		if err := attachment.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -1,6 +1,9 @@
 package beam
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // ValidationError represents a validation error
 type ValidationError struct {
@@ -20,3 +23,23 @@ func NewError(field, message string) error {
 		Message: message,
 	}
 }
+
+var (
+	// ErrUnknownFormat is returned when a requested feed format is not supported
+	ErrUnknownFormat = errors.New("unknown feed format")
+
+	// ErrNotAcceptable is returned when none of the formats in an Accept header can be served
+	ErrNotAcceptable = errors.New("no acceptable feed format")
+
+	// ErrNoFeedFound is returned when feed discovery finds no feeds for a page
+	ErrNoFeedFound = errors.New("no feed found")
+
+	// ErrDuplicateSource is returned when adding a source whose URL is already aggregated
+	ErrDuplicateSource = errors.New("duplicate source")
+
+	// ErrSourceNotFound is returned when no source has the given ID
+	ErrSourceNotFound = errors.New("source not found")
+
+	// ErrPageNotFound is returned when an archive page does not exist
+	ErrPageNotFound = errors.New("archive page not found")
+)
@@ -0,0 +1,203 @@
+package beam
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies the kind of aggregator activity an Event reports
+type EventType string
+
+const (
+	// EventSourceAdded is published when a source is added
+	EventSourceAdded EventType = "source.added"
+	// EventSourceUpdated is published when a source is changed, enabled or disabled
+	EventSourceUpdated EventType = "source.updated"
+	// EventSourceRemoved is published when a source is removed
+	EventSourceRemoved EventType = "source.removed"
+	// EventFetchStarted is published when fetching a source begins
+	EventFetchStarted EventType = "fetch.started"
+	// EventFetchSucceeded is published when a source was fetched, including 304 responses
+	EventFetchSucceeded EventType = "fetch.succeeded"
+	// EventFetchFailed is published when fetching a source failed
+	EventFetchFailed EventType = "fetch.failed"
+	// EventEntryNew is published for each new entry of a source. The entries
+	// of the first fetch of a source and of its archive pages are not new.
+	EventEntryNew EventType = "entry.new"
+	// EventEntryUpdated is published for each aggregated entry whose fields changed
+	EventEntryUpdated EventType = "entry.updated"
+	// EventEntryRemoved is published for each entry that dropped out of its source feed
+	EventEntryRemoved EventType = "entry.removed"
+	// EventAggregationCompleted is published after the aggregated feed was rebuilt
+	EventAggregationCompleted EventType = "aggregation.completed"
+)
+
+// Event describes one piece of aggregator activity. Seq increases by one
+// with every published event. Source is a snapshot of the source the event
+// concerns; Entry, Changes, Error and EntryCount are set depending on Type.
+type Event struct {
+	Seq        uint64        `json:"seq"`
+	Type       EventType     `json:"type"`
+	Time       time.Time     `json:"time"`
+	SourceID   string        `json:"source_id,omitempty"`
+	Source     *FeedSource   `json:"source,omitempty"`
+	Entry      *Entry        `json:"entry,omitempty"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	EntryCount int           `json:"entry_count,omitempty"`
+}
+
+// Subscription receives aggregator events on C.
+//
+// Events are delivered in publication order. Delivery never blocks the
+// aggregator: when the subscriber's buffer is full the event is dropped
+// and counted in Dropped. C is closed by Unsubscribe.
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	types   map[EventType]bool
+	dropped atomic.Uint64
+	bus     *eventBus
+	once    sync.Once
+}
+
+// Dropped returns how many events were dropped because C was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe stops delivery and closes C. It is safe to call more than once.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.remove(s)
+	})
+}
+
+// eventBus fans events out to subscriptions
+type eventBus struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs map[*Subscription]struct{}
+}
+
+// subscribe registers a subscription for the given event types, or for
+// all events when none are given
+func (b *eventBus) subscribe(buffer int, types []EventType) *Subscription {
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, bus: b}
+	if len(types) > 0 {
+		sub.types = make(map[EventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[*Subscription]struct{})
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// remove unregisters a subscription and closes its channel
+func (b *eventBus) remove(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, sub)
+	close(sub.ch)
+}
+
+// publish stamps the event and offers it to every interested subscription
+// without blocking. Holding the lock across the fan-out keeps the order of
+// events identical for all subscribers.
+func (b *eventBus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.Seq = b.seq
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	for sub := range b.subs {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a subscription to aggregator events of the given types,
+// or to all events when no types are given. buffer sets how many events
+// may queue up for a slow subscriber before further events are dropped.
+func (a *Aggregator) Subscribe(buffer int, types ...EventType) *Subscription {
+	return a.events.subscribe(buffer, types)
+}
+
+// publishSourceEvent publishes an event about a source
+func (a *Aggregator) publishSourceEvent(eventType EventType, src FeedSource, err error) {
+	event := Event{Type: eventType, SourceID: src.ID, Source: &src}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	a.events.publish(event)
+}
+
+// publishEntryEventsLocked publishes entry events for the changesets of a
+// refresh, carrying the entries as they appear in the aggregated feed.
+// Entries excluded by the aggregator's filter are not reported, nor are the
+// entries of a source's first fetch and backfilled entries, which would
+// flood subscribers with old posts.
+// The caller must hold a.mu.
+func (a *Aggregator) publishEntryEventsLocked(changesets []Changeset) {
+	for _, changeset := range changesets {
+		i := a.sourceIndexLocked(changeset.SourceID)
+		if i < 0 {
+			continue
+		}
+		src := a.Sources[i]
+
+		publish := func(eventType EventType, entryID string, changes []FieldChange) {
+			record, ok := a.history.get(src.ID, entryID)
+			if !ok {
+				// Retracted entries are no longer in the history
+				if record.Entry, ok = changeset.retracted[entryID]; !ok {
+					return
+				}
+			}
+			entry := a.enrichEntryLocked(src, record.Entry)
+			if !a.filter.Match(entry) {
+				return
+			}
+			a.events.publish(Event{
+				Type:     eventType,
+				Time:     changeset.FetchedAt,
+				SourceID: src.ID,
+				Source:   &src,
+				Entry:    &entry,
+				Changes:  changes,
+			})
+		}
+
+		if !changeset.Initial {
+			for _, id := range changeset.New {
+				publish(EventEntryNew, id, nil)
+			}
+		}
+		for _, update := range changeset.Updated {
+			publish(EventEntryUpdated, update.ID, update.Changes)
+		}
+		for _, id := range changeset.Removed {
+			publish(EventEntryRemoved, id, nil)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package beam
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFirstFetchPublishesNoNewEntryEvents(t *testing.T) {
+	// The source starts with entries 1 to 3; entry 0 is published later
+	entries := testEntries(4)
+	var count atomic.Int32
+	count.Store(3)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feed := NewFeed("Source", "https://example.com/feed")
+		feed.Items = entries[len(entries)-int(count.Load()):]
+		data, _ := feed.Encode(FormatBEAM)
+		w.Write(data)
+	}))
+	defer source.Close()
+
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	sub := a.Subscribe(100, EventEntryNew)
+	defer sub.Unsubscribe()
+	if _, err := a.AddSource("Source", "", source.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	a.FetchAllFeeds()
+	select {
+	case event := <-sub.C:
+		t.Fatalf("first fetch published %s for %s", event.Type, event.Entry.ID)
+	default:
+	}
+
+	count.Store(4)
+	a.FetchAllFeeds()
+	select {
+	case event := <-sub.C:
+		if event.Entry.ID != "0" {
+			t.Fatalf("entry.new for %s, want 0", event.Entry.ID)
+		}
+	default:
+		t.Fatal("no entry.new event for the new entry")
+	}
+	select {
+	case event := <-sub.C:
+		t.Fatalf("unexpected entry.new for %s", event.Entry.ID)
+	default:
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,9 +12,38 @@ import (
 )
 
 func main() {
-	aggregator := beam.NewAggregator("Tech News Aggregator", "http://localhost:8181/feed.json")
-	aggregator.AddSource("Feed 01", "Latest technology news and startup coverage", "http://localhost:8081/feed.json")
-	aggregator.AddSource("Feed 02", "Social news for hackers and entrepreneurs", "http://localhost:8082/feed.json")
+	configPath := flag.String("config", "", "path to an aggregator config file (hot reloaded)")
+	statePath := flag.String("state", "", "path to a file persisting aggregator state across restarts")
+	websubCallback := flag.String("websub", "", "public URL of /websub; subscribes to sources advertising a WebSub hub")
+	flag.Parse()
+
+	var aggregator *beam.Aggregator
+	if *configPath != "" {
+		cfg, err := beam.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		if aggregator, err = beam.NewAggregatorFromConfig(cfg); err != nil {
+			log.Fatalf("Failed to create aggregator: %v", err)
+		}
+		defer aggregator.WatchConfig(*configPath, 2*time.Second)()
+	} else {
+		aggregator = beam.NewAggregator("Tech News Aggregator", "http://localhost:8181/feed.json")
+		aggregator.AddSource("Feed 01", "Latest technology news and startup coverage", "http://localhost:8081/feed.json")
+		aggregator.AddSource("Feed 02", "Social news for hackers and entrepreneurs", "http://localhost:8082/feed.json")
+	}
+
+	if *statePath != "" {
+		if err := aggregator.SetStore(beam.NewFileStore(*statePath)); err != nil {
+			log.Fatalf("Failed to restore state: %v", err)
+		}
+	}
+
+	if *websubCallback != "" {
+		if err := aggregator.EnableWebSub(*websubCallback); err != nil {
+			log.Fatalf("Failed to enable WebSub: %v", err)
+		}
+	}
 
 	fmt.Println("\n=== Initial Feed Fetch ===")
 	if err := aggregator.FetchAllFeeds(); err != nil {
@@ -38,11 +68,18 @@ func main() {
 		}
 	}
 
-	// Start auto-refresh every 5 seconds
-	aggregator.StartAutoRefresh(5 * time.Second)
+	// Start auto-refresh every 5 seconds, unless the config file manages it
+	if *configPath == "" {
+		aggregator.StartAutoRefresh(5 * time.Second)
+	}
 
 	http.HandleFunc("/", aggregator.HomePage)
 	http.Handle("/feed.json", aggregator)
+	http.HandleFunc("/websub", aggregator.WebSubCallback)
+
+	events := beam.NewEventStream(aggregator, 256)
+	defer events.Close()
+	http.Handle("/events", events)
 
 	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -51,7 +88,7 @@ func main() {
 
 	http.HandleFunc("/sources", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(aggregator.Sources)
+		json.NewEncoder(w).Encode(aggregator.GetSources())
 	})
 
 	log.Fatal(http.ListenAndServe(":8181", nil))
@@ -59,11 +59,17 @@ func main() {
 	fmt.Printf("Feed title: %s\n", feed.Title)
 	fmt.Printf("Feed URL: %s\n", feed.FeedURL)
 
+	// Serve an embedded WebSub hub so subscribers get updates pushed
+	hub := beam.NewHub("http://localhost:8081/hub", beam.NewMemoryHubStore())
+	hub.SetTopicFilter(func(topic string) bool { return topic == feed.FeedURL })
+	feed.SetHub("http://localhost:8081/hub")
+
 	fmt.Println("\n=== Starting HTTP Server ===")
 	fmt.Println("Feed available at: http://localhost:8081/feed.json")
 	fmt.Println("Press Ctrl+C to stop the server")
 
 	http.Handle("/feed.json", feed)
+	http.Handle("/hub", hub)
 	http.HandleFunc("/", feed.HomePage)
 
 	http.ListenAndServe(":8081", nil)
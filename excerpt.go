@@ -0,0 +1,116 @@
+package beam
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// DefaultExcerptLength is the default length, in characters, of the
+// excerpts made for entries without a summary
+const DefaultExcerptLength = 280
+
+// excerptSkipped are the elements left out of excerpts with their content
+// besides scripts, styles and the other dropped elements: code blocks
+var excerptSkipped = map[string]bool{
+	"pre": true,
+}
+
+// blockElements break the text flow; tags of other elements join the text
+// around them without a space
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "dd": true, "details": true, "div": true, "dl": true,
+	"dt": true, "figcaption": true, "footer": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "img": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "section": true, "summary": true, "td": true,
+	"th": true, "tr": true, "ul": true,
+}
+
+// Excerpt returns a plain-text excerpt of HTML content of at most
+// maxLength characters. Markup is stripped, entities are decoded and code
+// blocks are left out. Longer text is cut after the last complete sentence
+// that keeps at least half of maxLength, or else at a word boundary,
+// marked with an ellipsis. A maxLength of 0 or less returns the whole text.
+func Excerpt(content string, maxLength int) string {
+	text := plainText(content)
+	if maxLength <= 0 {
+		return text
+	}
+	return truncateText(text, maxLength)
+}
+
+// plainText returns the text of HTML content with whitespace collapsed
+func plainText(content string) string {
+	s := sanitizer{content: content}
+	var b strings.Builder
+	for s.pos < len(s.content) {
+		lt := strings.IndexByte(s.content[s.pos:], '<')
+		if lt < 0 {
+			b.WriteString(s.content[s.pos:])
+			break
+		}
+		b.WriteString(s.content[s.pos : s.pos+lt])
+		s.pos += lt
+
+		rest := s.content[s.pos:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			s.skipPast("-->")
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			s.skipPast(">")
+		case len(rest) > 1 && (isASCIILetter(rest[1]) || (rest[1] == '/' && len(rest) > 2 && isASCIILetter(rest[2]))):
+			tag := s.readTag()
+			if !tag.end && !voidElements[tag.name] && (droppedElements[tag.name] || excerptSkipped[tag.name]) {
+				s.skipElement(tag.name)
+				b.WriteByte(' ')
+			} else if blockElements[tag.name] {
+				b.WriteByte(' ')
+			}
+		default:
+			b.WriteByte('<')
+			s.pos++
+		}
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(b.String())), " ")
+}
+
+// truncateText shortens text to at most maxLength characters, at a
+// sentence or word boundary
+func truncateText(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	// The end of the last complete sentence that fits
+	for i := maxLength - 1; i >= maxLength/2; i-- {
+		if isSentenceEnd(runes, i) {
+			return string(runes[:i+1])
+		}
+	}
+
+	// The last word that fits with the ellipsis
+	cut := maxLength - 1
+	for i := cut; i > 0; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// isSentenceEnd reports whether runes[i] ends a sentence
+func isSentenceEnd(runes []rune, i int) bool {
+	switch runes[i] {
+	case '。', '！', '？':
+		return true
+	case '.', '!', '?':
+		return i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+	}
+	return false
+}
@@ -8,9 +8,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"html/template"
 	"net/http"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -35,15 +35,33 @@ type Author struct {
 
 // Feed represents a complete BEAM feed
 type Feed struct {
-	Version     string     `json:"version"`
-	Title       string     `json:"title"`
-	Description string     `json:"description,omitempty"`
-	HomePageURL string     `json:"home_page_url,omitempty"`
-	FeedURL     string     `json:"feed_url"`
-	Language    string     `json:"language,omitempty"`
-	Author      *Author    `json:"author,omitempty"`
-	LastUpdated *time.Time `json:"last_updated,omitempty"`
-	Items       []Entry    `json:"items"`
+	Version     string      `json:"version"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	HomePageURL string      `json:"home_page_url,omitempty"`
+	FeedURL     string      `json:"feed_url"`
+	Language    string      `json:"language,omitempty"`
+	Author      *Author     `json:"author,omitempty"`
+	Hub         string      `json:"hub,omitempty"`
+	LastUpdated *time.Time  `json:"last_updated,omitempty"`
+	NextURL     string      `json:"next_url,omitempty"`
+	Delta       bool        `json:"delta,omitempty"` // whether Items only holds changes, see FeedQuery.Since
+	Items       []Entry     `json:"items"`
+	Tombstones  []Tombstone `json:"tombstones,omitempty"`
+
+	// Archived feed links (RFC 5005): the archive page before and after
+	// this document, the current document, and whether this is an archive page
+	PrevArchiveURL string `json:"prev_archive_url,omitempty"`
+	NextArchiveURL string `json:"next_archive_url,omitempty"`
+	CurrentURL     string `json:"current_url,omitempty"`
+	Archive        bool   `json:"archive,omitempty"`
+
+	archivePageSize int
+	lastSeq         uint64        // sequence number of the last entry added, see archiveSlots
+	holdPing        bool          // whether notifyHub only records the ping, see Publisher.Update
+	pingHeld        bool          // whether a ping was held back
+	encoded         *encodedCache // documents of the current version, see ServeHTTP
+	pages           *Pages
 }
 
 // NewFeed creates a new BEAM feed with required fields
@@ -55,14 +73,71 @@ func NewFeed(title, feedURL string) *Feed {
 		FeedURL:     feedURL,
 		LastUpdated: &now,
 		Items:       make([]Entry, 0),
+		encoded:     &encodedCache{},
 	}
 }
 
-// AddEntry adds an entry to the feed
+// AddEntry adds an entry to the feed and pings the feed's WebSub hub, if any
 func (f *Feed) AddEntry(entry Entry) {
+	entry.changed = f.markChanged()
+	f.lastSeq++
+	entry.seq = f.lastSeq
 	f.Items = append(f.Items, entry)
-	now := time.Now().UTC()
-	f.LastUpdated = &now
+	f.notifyHub()
+}
+
+// UpsertEntry replaces the entry with the same ID, or adds the entry if
+// the feed has none. A tombstone of an earlier deletion of the ID is dropped.
+func (f *Feed) UpsertEntry(entry Entry) {
+	entry.changed = f.markChanged()
+	// A replaced or restored entry keeps its place on the archive pages
+	entry.seq = 0
+	for i, tombstone := range f.Tombstones {
+		if tombstone.ID == entry.ID {
+			entry.seq = tombstone.seq
+			f.Tombstones = append(f.Tombstones[:i], f.Tombstones[i+1:]...)
+			break
+		}
+	}
+	replaced := false
+	for i := range f.Items {
+		if f.Items[i].ID == entry.ID {
+			entry.seq = f.Items[i].seq
+			f.Items[i] = entry
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		if entry.seq == 0 {
+			f.lastSeq++
+			entry.seq = f.lastSeq
+		}
+		f.Items = append(f.Items, entry)
+	}
+	f.notifyHub()
+}
+
+// RemoveEntry removes the entry with the given ID and leaves a tombstone
+// in its place, so consumers learn of the deletion. It reports whether the
+// feed had the entry.
+func (f *Feed) RemoveEntry(id string) bool {
+	index := -1
+	for i, entry := range f.Items {
+		if entry.ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return false
+	}
+	seq := f.Items[index].seq
+	f.Items = append(f.Items[:index], f.Items[index+1:]...)
+
+	f.Tombstones = append(f.Tombstones, Tombstone{ID: id, Deleted: f.markChanged(), seq: seq})
+	f.notifyHub()
+	return true
 }
 
 // SetAuthor sets the feed author
@@ -84,6 +159,12 @@ func (f *Feed) SetHomePageURL(url string) {
 	f.HomePageURL = url
 }
 
+// SetHub sets the WebSub hub that subscribers are pointed to and that is
+// pinged when entries are added
+func (f *Feed) SetHub(hubURL string) {
+	f.Hub = hubURL
+}
+
 // SetLanguage sets the feed language
 func (f *Feed) SetLanguage(language string) {
 	f.Language = language
@@ -107,6 +188,22 @@ func (f *Feed) Validate() error {
 		return NewError("home_page_url", "home_page_url must be a valid URL")
 	}
 
+	if f.Hub != "" && !isValidURL(f.Hub) {
+		return NewError("hub", "hub must be a valid URL")
+	}
+
+	links := []struct{ field, url string }{
+		{"next_url", f.NextURL},
+		{"prev_archive_url", f.PrevArchiveURL},
+		{"next_archive_url", f.NextArchiveURL},
+		{"current_url", f.CurrentURL},
+	}
+	for _, link := range links {
+		if link.url != "" && !isValidURL(link.url) {
+			return NewError(link.field, link.field+" must be a valid URL")
+		}
+	}
+
 	entryIDs := make(map[string]bool)
 	for i, entry := range f.Items {
 		if err := entry.Validate(); err != nil {
@@ -118,6 +215,12 @@ func (f *Feed) Validate() error {
 		entryIDs[entry.ID] = true
 	}
 
+	for i, tombstone := range f.Tombstones {
+		if strings.TrimSpace(tombstone.ID) == "" {
+			return NewError("tombstones", fmt.Sprintf("tombstone %d: id is required", i))
+		}
+	}
+
 	return nil
 }
 
@@ -140,44 +243,18 @@ func FromJSON(data []byte) (*Feed, error) {
 	return &feed, nil
 }
 
-// FetchFeed fetches a BEAM feed from a URL
+// FetchFeed fetches a feed from a URL.
+// BEAM feeds are preferred; JSON Feed, RSS and Atom documents are converted.
+// Use FetchFeedHistory to also fetch the feed's archive pages.
 func FetchFeed(url string) (*Feed, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch feed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	return FromJSON(body)
+	return fetchFeedPage(http.DefaultClient, url)
 }
 
 // CalculateReadingTime estimates reading time in minutes based on word count
-// Assumes average reading speed of 200 words per minute
+// Assumes average reading speed of 200 words per minute; see
+// ReadingTimeEstimator for other speeds, CJK text, images and code
 func CalculateReadingTime(content string) int {
-	if content == "" {
-		return 0
-	}
-
-	// Remove HTML tags for word counting
-	re := regexp.MustCompile(`<[^>]*>`)
-	plainText := re.ReplaceAllString(content, " ")
-
-	// Count words
-	words := strings.Fields(plainText)
-	wordCount := len(words)
-
-	// Calculate reading time (200 words per minute, minimum 1 minute)
-	readingTime := wordCount / 200
-	return max(readingTime, 1)
+	return DefaultReadingTimeEstimator.Minutes(content)
 }
 
 // isValidURL checks if a string is a valid HTTP/HTTPS URL
@@ -256,73 +333,166 @@ func (f *Feed) GetCategories() []string {
 	return categories
 }
 
-// ServeHTTP implements http.Handler for serving BEAM feeds
+// ServeHTTP implements http.Handler for serving BEAM feeds.
+// The representation is negotiated from the ?format= parameter or the
+// Accept header, so one URL can serve BEAM JSON, JSON Feed, RSS, Atom and HTML.
+// The entries can be narrowed and paged with the query parameters read by
+// ParseFeedQuery; the next page is linked from next_url and a Link header.
+// Archive pages, see SetArchivePageSize, are served with ?page=N.
+// Clients can fetch only the changes after the cursor of their previous
+// response with the since parameter or the X-Beam-Since header.
+// Documents are compressed with gzip or deflate as the Accept-Encoding
+// header allows, JSON is written without indentation for ?compact=true,
+// and encoded documents are cached until the feed changes.
+// The feed must not be modified while it is served; serve feeds that
+// change through a Publisher.
 func (f *Feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", ContentTypeJSON)
-	w.Header().Set("Cache-Control", DefaultCacheControl)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Add("Vary", SinceHeader)
+
+	format, err := NegotiateFormat(r)
+	if errors.Is(err, ErrNotAcceptable) {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Permalink pages are part of the HTML representation
+	if format == FormatHTML && r.URL.Query().Has("entry") {
+		f.HomePage(w, r)
+		return
+	}
+
+	values := r.URL.Query()
+	if since := r.Header.Get(SinceHeader); since != "" && !values.Has("since") {
+		values.Set("since", since)
+	}
+	query, err := ParseFeedQuery(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := docKey{format: format, coding: negotiateCoding(r.Header.Get("Accept-Encoding"))}
+	if compact := values.Get("compact"); compact != "" {
+		if key.compact, err = strconv.ParseBool(compact); err != nil {
+			http.Error(w, "compact must be a boolean", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Archive pages are selected with ?page=; with archiving enabled and no
+	// query, the current document holds only the newest entries
+	view, cacheControl := f, DefaultCacheControl
+	if page := values.Get("page"); page != "" {
+		if key.page, err = strconv.Atoi(page); err != nil {
+			http.Error(w, "page must be an integer", http.StatusBadRequest)
+			return
+		}
+		if view, err = f.ArchivePage(key.page); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		cacheControl = ArchiveCacheControl
+	} else if f.archivePageSize > 0 && query.IsZero() {
+		view = f.CurrentDocument()
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Cache-Control", cacheControl)
+	if f.Hub != "" {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, f.Hub))
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="self"`, f.FeedURL))
+	}
 
 	if f.LastUpdated != nil {
 		w.Header().Set("Last-Modified", f.LastUpdated.Format(http.TimeFormat))
+		w.Header().Set(CursorHeader, encodeSyncCursor(*f.LastUpdated))
 	}
 
-	// Generate ETag based on last updated time and item count
-	etag := fmt.Sprintf(`"beam-%d-%d"`, f.LastUpdated.Unix(), len(f.Items))
+	// Generate ETag based on the feed version, representation and query
+	etag := f.etag(key, queryVariant(values))
 	w.Header().Set("ETag", etag)
 
 	// Check if client has cached version
-	if r.Header.Get("If-None-Match") == etag {
+	if notModified(r, etag, f.LastUpdated) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	data, err := f.ToJSON()
+	if !query.IsZero() {
+		page, next, err := view.Query(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if next != "" {
+			page.NextURL = withQuery(withQueryValues(f.FeedURL, values), "cursor", next)
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, page.NextURL))
+		}
+		view = page
+	}
+	if view.PrevArchiveURL != "" {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="prev-archive"`, view.PrevArchiveURL))
+	}
+	if view.NextArchiveURL != "" {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next-archive"`, view.NextArchiveURL))
+	}
+
+	// Documents of the current version are the same for every request
+	// without query
+	var data []byte
+	if f.encoded != nil && query.IsZero() {
+		data, err = f.encoded.get(f.version(), key, func() ([]byte, error) { return view.encodeDocument(key) })
+	} else {
+		data, err = view.encodeDocument(key)
+	}
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	if key.coding != "" {
+		w.Header().Set("Content-Encoding", key.coding)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
 	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
 }
 
-// HomePage ...
+// HomePage serves the HTML page listing the feed entries, and the
+// permalink page of an entry for ?entry=<id>
 func (f *Feed) HomePage(w http.ResponseWriter, r *http.Request) {
-	html := `
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<title>BEAM Feed Example</title>
-			<style>
-				body { font-family: Arial, sans-serif; margin: 40px; }
-				.feed-info { margin: 20px 0; }
-				.entry { border: 1px solid #ddd; margin: 10px 0; padding: 15px; border-radius: 5px; }
-				.tags { color: #666; font-size: 0.9em; }
-			</style>
-		</head>
-		<body>
-			<h1>BEAM Feed Example</h1>
-			<p>This is a demonstration of the BEAM (Blog Entry Aggregation Method) protocol.</p>
-			<p><strong>Feed URL:</strong> <a href="/feed.json">/feed.json</a></p> <hr/></br>
-			
-			<div class="feed-info">
-				<h2>` + f.Title + `</h2>
-				<p>` + f.Description + `</p>
-				<p><strong>Entries:</strong> ` + fmt.Sprintf("%d", len(f.Items)) + `</p>
-			</div>
-			
-			<h3>Recent Entries</h3>`
+	pagesOrDefault(f.pages).serve(w, r, "feed", f.pageData())
+}
 
-	for _, entry := range f.Items {
-		html += fmt.Sprintf(`<div class="entry"><h4><a href="%s">%s</a></h4><p>%s</p>
-			<div class="tags"><strong>Category:</strong> %s<br><strong>Tags:</strong> %v<br>
-			<strong>Reading time:</strong> %d minutes<br><strong>Published:</strong> %s</div></div>`,
-			entry.URL, entry.Title, entry.Summary, entry.Category, entry.Tags,
-			entry.ReadingTime, entry.Published.Local().Format("2006-01-02 15:04"))
+// SetPages sets the templates and theme of the feed's HTML pages.
+// nil restores the default pages.
+func (f *Feed) SetPages(pages *Pages) {
+	f.pages = pages
+	if f.encoded != nil {
+		// Drop HTML documents rendered with the previous pages
+		f.encoded = &encodedCache{}
 	}
+}
 
-	html += `</body></html>`
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+// pageData returns the data of the feed's HTML page
+func (f *Feed) pageData() PageData {
+	return PageData{
+		Feed:           f,
+		Entries:        f.Items,
+		AlternateLinks: template.HTML(f.AlternateLinks()),
+	}
 }
 
 // ComputeFeedHash calculates the SHA-256 hash of the serialized feed content.
@@ -0,0 +1,122 @@
+package beam
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveFeed sends a request for the feed with the given headers
+func serveFeed(f *Feed, method, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Accept", MediaTypeBEAM)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	f.ServeHTTP(rec, req)
+	return rec
+}
+
+// newServedFeed returns a feed with three entries
+func newServedFeed() *Feed {
+	f := NewFeed("Test", "https://example.com/feed")
+	for _, entry := range testEntries(3) {
+		f.AddEntry(entry)
+	}
+	return f
+}
+
+func TestServeHTTPCompression(t *testing.T) {
+	f := newServedFeed()
+	plain := serveFeed(f, http.MethodGet, "/feed", nil)
+	if coding := plain.Header().Get("Content-Encoding"); coding != "" {
+		t.Fatalf("uncompressed response has Content-Encoding %q", coding)
+	}
+
+	tests := []struct {
+		acceptEncoding string
+		coding         string
+		decompress     func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"deflate", "deflate", func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+		{"deflate, gzip;q=0.5", "deflate", func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+		{"gzip;q=0, *", "deflate", func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+		{"br", "", nil},
+	}
+	for _, tt := range tests {
+		rec := serveFeed(f, http.MethodGet, "/feed", map[string]string{"Accept-Encoding": tt.acceptEncoding})
+		if coding := rec.Header().Get("Content-Encoding"); coding != tt.coding {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", tt.acceptEncoding, coding, tt.coding)
+			continue
+		}
+		if tt.decompress == nil {
+			continue
+		}
+		r, err := tt.decompress(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(body, plain.Body.Bytes()) {
+			t.Errorf("Accept-Encoding %q: decompressed body differs from the uncompressed one", tt.acceptEncoding)
+		}
+	}
+}
+
+func TestServeHTTPHead(t *testing.T) {
+	f := newServedFeed()
+	get := serveFeed(f, http.MethodGet, "/feed", map[string]string{"Accept-Encoding": "gzip"})
+	head := serveFeed(f, http.MethodHead, "/feed", map[string]string{"Accept-Encoding": "gzip"})
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Fatalf("HEAD: status %d with %d body bytes", head.Code, head.Body.Len())
+	}
+	for _, name := range []string{"Content-Length", "Content-Encoding", "ETag", "Last-Modified"} {
+		if head.Header().Get(name) != get.Header().Get(name) {
+			t.Errorf("HEAD %s = %q, GET sent %q", name, head.Header().Get(name), get.Header().Get(name))
+		}
+	}
+}
+
+func TestServeHTTPNotModified(t *testing.T) {
+	f := newServedFeed()
+	first := serveFeed(f, http.MethodGet, "/feed", nil)
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		code    int
+	}{
+		{"matching ETag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"weak ETag in list", map[string]string{"If-None-Match": `"other", W/` + etag}, http.StatusNotModified},
+		{"other ETag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"Last-Modified", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"earlier date", map[string]string{"If-Modified-Since": time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}, http.StatusOK},
+		{"If-None-Match overrides", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := serveFeed(f, http.MethodGet, "/feed", tt.headers)
+		if rec.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.code)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("%s: 304 with a body", tt.name)
+		}
+	}
+
+	// A change to the feed invalidates the validators
+	f.AddEntry(NewEntry("new", "New", "https://example.com/new", time.Now()))
+	if rec := serveFeed(f, http.MethodGet, "/feed", map[string]string{"If-None-Match": etag}); rec.Code != http.StatusOK {
+		t.Fatalf("status after a change = %d, want 200", rec.Code)
+	}
+}
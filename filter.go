@@ -0,0 +1,70 @@
+package beam
+
+import "strings"
+
+// EntryFilter selects entries by tag, category and, for aggregated
+// entries, source ID.
+// Include lists match entries having any of the listed values; an empty
+// include list matches everything. Exclude lists take precedence.
+// All comparisons are case-insensitive.
+type EntryFilter struct {
+	Tags              []string `json:"tags,omitempty"`
+	ExcludeTags       []string `json:"exclude_tags,omitempty"`
+	Categories        []string `json:"categories,omitempty"`
+	ExcludeCategories []string `json:"exclude_categories,omitempty"`
+	Sources           []string `json:"sources,omitempty"`
+}
+
+// IsZero reports whether the filter matches every entry
+func (f EntryFilter) IsZero() bool {
+	return len(f.Tags) == 0 && len(f.ExcludeTags) == 0 &&
+		len(f.Categories) == 0 && len(f.ExcludeCategories) == 0 && len(f.Sources) == 0
+}
+
+// Match reports whether the entry passes the filter
+func (f EntryFilter) Match(entry Entry) bool {
+	if containsFold(f.ExcludeCategories, entry.Category) {
+		return false
+	}
+	for _, tag := range entry.Tags {
+		if containsFold(f.ExcludeTags, tag) {
+			return false
+		}
+	}
+
+	if len(f.Categories) > 0 && !containsFold(f.Categories, entry.Category) {
+		return false
+	}
+	if len(f.Sources) > 0 && !containsFold(f.Sources, entrySourceID(entry)) {
+		return false
+	}
+	if len(f.Tags) > 0 {
+		for _, tag := range entry.Tags {
+			if containsFold(f.Tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// containsFold reports whether list contains value, ignoring case
+func containsFold(list []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// entrySourceID returns the source ID recorded on an aggregated entry
+func entrySourceID(entry Entry) string {
+	id, _ := entry.GetExtension(KindSourceExtension)
+	s, _ := id.(string)
+	return s
+}
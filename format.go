@@ -0,0 +1,297 @@
+package beam
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MediaTypeBEAM is the media type used to advertise BEAM feeds in Accept headers and link tags
+	MediaTypeBEAM = "application/beam+json"
+
+	// ContentTypeJSONFeed is the content type for JSON Feed documents
+	ContentTypeJSONFeed = "application/feed+json; charset=utf-8"
+
+	// ContentTypeRSS is the content type for RSS 2.0 documents
+	ContentTypeRSS = "application/rss+xml; charset=utf-8"
+
+	// ContentTypeAtom is the content type for Atom documents
+	ContentTypeAtom = "application/atom+xml; charset=utf-8"
+
+	// ContentTypeHTML is the content type for HTML pages
+	ContentTypeHTML = "text/html; charset=utf-8"
+)
+
+// Format identifies a representation of a feed that can be served over HTTP
+type Format string
+
+const (
+	// FormatBEAM is the native BEAM JSON representation
+	FormatBEAM Format = "beam"
+	// FormatJSONFeed is the JSON Feed 1.1 representation
+	FormatJSONFeed Format = "jsonfeed"
+	// FormatRSS is the RSS 2.0 representation
+	FormatRSS Format = "rss"
+	// FormatAtom is the Atom (RFC 4287) representation
+	FormatAtom Format = "atom"
+	// FormatHTML is the human readable HTML page
+	FormatHTML Format = "html"
+)
+
+// wildcardFormats lists the formats a wildcard media range stands for,
+// most preferred first
+var wildcardFormats = map[string][]Format{
+	"*/*":           {FormatBEAM, FormatJSONFeed, FormatAtom, FormatRSS, FormatHTML},
+	"application/*": {FormatBEAM, FormatJSONFeed, FormatAtom, FormatRSS},
+	"text/*":        {FormatHTML, FormatRSS},
+}
+
+// formatAliases maps accepted values of the ?format= parameter to formats
+var formatAliases = map[string]Format{
+	"beam":     FormatBEAM,
+	"json":     FormatBEAM,
+	"jsonfeed": FormatJSONFeed,
+	"feed":     FormatJSONFeed,
+	"rss":      FormatRSS,
+	"xml":      FormatRSS,
+	"atom":     FormatAtom,
+	"html":     FormatHTML,
+}
+
+// mediaTypeFormats maps media types found in Accept headers to formats
+var mediaTypeFormats = map[string]Format{
+	MediaTypeBEAM:           FormatBEAM,
+	"application/json":      FormatBEAM,
+	"application/feed+json": FormatJSONFeed,
+	"application/rss+xml":   FormatRSS,
+	"application/xml":       FormatRSS,
+	"text/xml":              FormatRSS,
+	"application/atom+xml":  FormatAtom,
+	"text/html":             FormatHTML,
+	"application/xhtml+xml": FormatHTML,
+}
+
+// ParseFormat returns the format named by s, as accepted by the ?format= parameter
+func ParseFormat(s string) (Format, error) {
+	format, ok := formatAliases[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+	}
+	return format, nil
+}
+
+// ContentType returns the Content-Type header value for the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSONFeed:
+		return ContentTypeJSONFeed
+	case FormatRSS:
+		return ContentTypeRSS
+	case FormatAtom:
+		return ContentTypeAtom
+	case FormatHTML:
+		return ContentTypeHTML
+	default:
+		return ContentTypeJSON
+	}
+}
+
+// NegotiateFormat selects the representation requested by r.
+// An explicit ?format= parameter wins over the Accept header. Requests
+// without an Accept header, or accepting anything, receive BEAM JSON.
+func NegotiateFormat(r *http.Request) (Format, error) {
+	if param := r.URL.Query().Get("format"); param != "" {
+		return ParseFormat(param)
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return FormatBEAM, nil
+	}
+
+	type candidate struct {
+		format Format
+		q      float64
+		order  int
+	}
+
+	type wildcard struct {
+		mediaRange string
+		q          float64
+		order      int
+	}
+
+	var candidates []candidate
+	var wildcards []wildcard
+	excluded := make(map[Format]bool)
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		if _, ok := wildcardFormats[mediaType]; ok {
+			if q > 0 {
+				// Wildcards rank below any explicit media type with the same weight
+				wildcards = append(wildcards, wildcard{mediaRange: mediaType, q: q - 0.0001, order: i})
+			}
+			continue
+		}
+		format, ok := mediaTypeFormats[mediaType]
+		switch {
+		case !ok:
+		case q <= 0:
+			excluded[format] = true
+		default:
+			candidates = append(candidates, candidate{format: format, q: q, order: i})
+		}
+	}
+
+	// A wildcard stands for the preferred format that was not excluded
+	for _, w := range wildcards {
+		for _, format := range wildcardFormats[w.mediaRange] {
+			if !excluded[format] {
+				candidates = append(candidates, candidate{format: format, q: w.q, order: w.order})
+				break
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", ErrNotAcceptable
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].order < candidates[j].order
+	})
+	return candidates[0].format, nil
+}
+
+// Encode serializes the feed in the given format
+func (f *Feed) Encode(format Format) ([]byte, error) {
+	switch format {
+	case FormatBEAM:
+		return f.ToJSON()
+	case FormatJSONFeed:
+		return f.ToJSONFeed()
+	case FormatRSS:
+		return f.ToRSS()
+	case FormatAtom:
+		return f.ToAtom()
+	case FormatHTML:
+		var buf bytes.Buffer
+		if err := pagesOrDefault(f.pages).render(&buf, "feed", f.pageData()); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// etag returns the entity tag of a document of the feed.
+// variant distinguishes views of the feed, such as query results.
+func (f *Feed) etag(key docKey, variant string) string {
+	tag := "beam-" + f.version()
+	if key.format != FormatBEAM {
+		tag += "-" + string(key.format)
+	}
+	if key.compact {
+		tag += "-compact"
+	}
+	if variant != "" {
+		tag += "-" + variant
+	}
+	if key.coding != "" {
+		tag += "-" + key.coding
+	}
+	return `"` + tag + `"`
+}
+
+// ParseFeed decodes a feed document in any of the supported formats.
+// BEAM JSON is parsed strictly; JSON Feed, RSS and Atom documents are
+// converted to BEAM, skipping items that cannot be represented. feedURL
+// is used when a converted document does not declare its own feed URL.
+func ParseFeed(data []byte, feedURL string) (*Feed, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("empty feed document")
+	}
+
+	var (
+		feed *Feed
+		err  error
+	)
+
+	switch trimmed[0] {
+	case '{':
+		var probe struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(trimmed, &probe); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		if !strings.HasPrefix(probe.Version, "https://jsonfeed.org/") {
+			return FromJSON(trimmed)
+		}
+		feed, err = fromJSONFeed(trimmed)
+	case '<':
+		switch xmlRootName(trimmed) {
+		case "rss":
+			feed, err = fromRSS(trimmed)
+		case "feed":
+			feed, err = fromAtom(trimmed)
+		default:
+			return nil, fmt.Errorf("%w: unrecognized XML document", ErrUnknownFormat)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unrecognized document", ErrUnknownFormat)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !isValidURL(feed.FeedURL) {
+		feed.FeedURL = feedURL
+	}
+	if strings.TrimSpace(feed.Title) == "" {
+		feed.Title = feed.FeedURL
+	}
+	if err := feed.Validate(); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	return feed, nil
+}
+
+// xmlRootName returns the local name of the root element of an XML document
+func xmlRootName(data []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
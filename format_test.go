@@ -0,0 +1,92 @@
+package beam
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   Format
+		err    error
+	}{
+		{"no Accept", "/feed", "", FormatBEAM, nil},
+		{"BEAM", "/feed", MediaTypeBEAM, FormatBEAM, nil},
+		{"plain JSON", "/feed", "application/json", FormatBEAM, nil},
+		{"JSON Feed", "/feed", "application/feed+json", FormatJSONFeed, nil},
+		{"browser", "/feed", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", FormatHTML, nil},
+		{"parameters", "/feed", "application/atom+xml; charset=utf-8", FormatAtom, nil},
+
+		// q-values
+		{"highest q wins", "/feed", "application/rss+xml;q=0.5, application/atom+xml;q=0.9", FormatAtom, nil},
+		{"order breaks ties", "/feed", "application/atom+xml, application/rss+xml", FormatAtom, nil},
+		{"q=0 excludes", "/feed", "application/atom+xml;q=0, application/rss+xml;q=0.1", FormatRSS, nil},
+		{"q=0 excludes from wildcards", "/feed", MediaTypeBEAM + ";q=0, */*", FormatJSONFeed, nil},
+		{"q=0.0 excludes", "/feed", "application/rss+xml;q=0.0", "", ErrNotAcceptable},
+		{"invalid q is ignored", "/feed", "application/rss+xml;q=high", FormatRSS, nil},
+
+		// Wildcards rank below explicit types of the same weight
+		{"any", "/feed", "*/*", FormatBEAM, nil},
+		{"wildcard first", "/feed", "*/*, application/rss+xml", FormatRSS, nil},
+		{"weighted wildcard", "/feed", "application/rss+xml;q=0.5, */*", FormatBEAM, nil},
+		{"application wildcard", "/feed", "application/*;q=0.9, text/html;q=0.8", FormatBEAM, nil},
+		{"text wildcard", "/feed", "text/*", FormatHTML, nil},
+		{"text wildcard without HTML", "/feed", "text/html;q=0, text/*", FormatRSS, nil},
+
+		// Not acceptable
+		{"unsupported type", "/feed", "image/png", "", ErrNotAcceptable},
+		{"everything excluded", "/feed", "*/*;q=0", "", ErrNotAcceptable},
+		{"malformed", "/feed", ";;;", "", ErrNotAcceptable},
+
+		// ?format= overrides the Accept header
+		{"format parameter", "/feed?format=atom", "application/rss+xml", FormatAtom, nil},
+		{"format alias", "/feed?format=json", "text/html", FormatBEAM, nil},
+		{"format parameter ignores q=0", "/feed?format=rss", "application/rss+xml;q=0", FormatRSS, nil},
+		{"unknown format", "/feed?format=csv", MediaTypeBEAM, "", ErrUnknownFormat},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		got, err := NegotiateFormat(req)
+		if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: format = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestServeHTTPNegotiationErrors(t *testing.T) {
+	f := newServedFeed()
+	tests := []struct {
+		target string
+		accept string
+		code   int
+	}{
+		{"/feed", "image/png", http.StatusNotAcceptable},
+		{"/feed", "application/rss+xml;q=0", http.StatusNotAcceptable},
+		{"/feed?format=csv", "", http.StatusBadRequest},
+		{"/feed?format=rss", "image/png", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Header.Set("Accept", tt.accept)
+		rec := httptest.NewRecorder()
+		f.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s with Accept %q: status = %d, want %d", tt.target, tt.accept, rec.Code, tt.code)
+		}
+	}
+	if rec := serveFeed(f, http.MethodGet, "/feed?format=rss", nil); rec.Header().Get("Content-Type") != ContentTypeRSS {
+		t.Errorf("?format=rss served as %q", rec.Header().Get("Content-Type"))
+	}
+}
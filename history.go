@@ -0,0 +1,267 @@
+package beam
+
+import (
+	"sort"
+	"time"
+)
+
+// EntryRecord is an entry remembered by the aggregator, with when it was
+// first and last seen in its source feed
+type EntryRecord struct {
+	SourceID  string    `json:"source_id"`
+	Entry     Entry     `json:"entry"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Changed   time.Time `json:"changed"` // when the entry was first seen or last seen changed
+	InFeed    bool      `json:"in_feed"` // whether the source's latest response contained the entry
+}
+
+// RetentionPolicy bounds the entry history. Zero values mean no limit.
+// Entries still in their source feed are never dropped, as they would be
+// reported as new again on the next fetch; they count towards the limits.
+type RetentionPolicy struct {
+	MaxAge       time.Duration // drop entries last seen longer ago than this
+	MaxPerSource int           // keep at most this many entries per source, newest first
+	MaxEntries   int           // keep at most this many entries overall, newest first
+}
+
+// entryHistory remembers every entry seen per source, so entries rotated
+// out of a publisher's feed stay in the aggregated feed.
+// It is guarded by the aggregator's mutex.
+type entryHistory struct {
+	records map[string]map[string]*EntryRecord // source ID -> entry ID -> record
+}
+
+// newEntryHistory creates an empty history
+func newEntryHistory() *entryHistory {
+	return &entryHistory{records: make(map[string]map[string]*EntryRecord)}
+}
+
+// observe records the entries of a fresh response from a source and
+// returns what changed since the previous response. Known entries are
+// updated in place; entries missing from the response are kept but no
+// longer marked as in the feed.
+func (h *entryHistory) observe(sourceID string, entries []Entry, seenAt time.Time) Changeset {
+	changeset := h.merge(sourceID, entries, seenAt)
+
+	inResponse := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		inResponse[entry.ID] = true
+	}
+	for id, record := range h.records[sourceID] {
+		if record.InFeed && !inResponse[id] {
+			record.InFeed = false
+			changeset.Removed = append(changeset.Removed, id)
+		}
+	}
+	sort.Strings(changeset.Removed)
+
+	return changeset
+}
+
+// merge records entries of a source without treating entries missing from
+// them as removed, for pushed content that may only carry the new entries
+func (h *entryHistory) merge(sourceID string, entries []Entry, seenAt time.Time) Changeset {
+	changeset := Changeset{SourceID: sourceID, FetchedAt: seenAt}
+
+	records, ok := h.records[sourceID]
+	if !ok {
+		records = make(map[string]*EntryRecord)
+		h.records[sourceID] = records
+		changeset.Initial = true
+	}
+
+	for _, entry := range entries {
+		record, ok := records[entry.ID]
+		if !ok {
+			record = &EntryRecord{SourceID: sourceID, FirstSeen: seenAt, Changed: seenAt}
+			records[entry.ID] = record
+			changeset.New = append(changeset.New, entry.ID)
+		} else if changes := diffEntries(record.Entry, entry); len(changes) > 0 {
+			changeset.Updated = append(changeset.Updated, EntryUpdate{ID: entry.ID, Changes: changes})
+			record.Changed = seenAt
+		}
+		record.Entry = entry
+		record.LastSeen = seenAt
+		record.InFeed = true
+	}
+
+	return changeset
+}
+
+// backfill records archived entries of a source that are not known yet,
+// as no longer in the feed, and returns their IDs
+func (h *entryHistory) backfill(sourceID string, entries []Entry, seenAt time.Time) []string {
+	records, ok := h.records[sourceID]
+	if !ok {
+		records = make(map[string]*EntryRecord)
+		h.records[sourceID] = records
+	}
+
+	var added []string
+	for _, entry := range entries {
+		if _, ok := records[entry.ID]; ok {
+			continue
+		}
+		records[entry.ID] = &EntryRecord{SourceID: sourceID, Entry: entry, FirstSeen: seenAt, LastSeen: seenAt, Changed: seenAt}
+		added = append(added, entry.ID)
+	}
+	sort.Strings(added)
+	return added
+}
+
+// retract forgets the entries of a source that its publisher deleted and
+// returns the records it dropped
+func (h *entryHistory) retract(sourceID string, tombstones []Tombstone) []EntryRecord {
+	var retracted []EntryRecord
+	for _, tombstone := range tombstones {
+		if record, ok := h.records[sourceID][tombstone.ID]; ok {
+			retracted = append(retracted, *record)
+			delete(h.records[sourceID], tombstone.ID)
+		}
+	}
+	return retracted
+}
+
+// touch marks the entries still in a source feed as seen, for responses
+// that reported no changes
+func (h *entryHistory) touch(sourceID string, seenAt time.Time) {
+	for _, record := range h.records[sourceID] {
+		if record.InFeed {
+			record.LastSeen = seenAt
+		}
+	}
+}
+
+// get returns the record of one entry of a source
+func (h *entryHistory) get(sourceID, entryID string) (EntryRecord, bool) {
+	record, ok := h.records[sourceID][entryID]
+	if !ok {
+		return EntryRecord{}, false
+	}
+	return *record, true
+}
+
+// hasSource reports whether any entries of the source are known
+func (h *entryHistory) hasSource(sourceID string) bool {
+	_, ok := h.records[sourceID]
+	return ok
+}
+
+// removeSource forgets every entry of a source
+func (h *entryHistory) removeSource(sourceID string) {
+	delete(h.records, sourceID)
+}
+
+// sourceRecords returns the records of a source, newest first
+func (h *entryHistory) sourceRecords(sourceID string) []EntryRecord {
+	records := make([]EntryRecord, 0, len(h.records[sourceID]))
+	for _, record := range h.records[sourceID] {
+		records = append(records, *record)
+	}
+	sortRecords(records)
+	return records
+}
+
+// all returns every record, newest first
+func (h *entryHistory) all() []EntryRecord {
+	var records []EntryRecord
+	for sourceID := range h.records {
+		records = append(records, h.sourceRecords(sourceID)...)
+	}
+	sortRecords(records)
+	return records
+}
+
+// restore replaces the history with saved records
+func (h *entryHistory) restore(records []EntryRecord) {
+	h.records = make(map[string]map[string]*EntryRecord)
+	for i := range records {
+		record := records[i]
+		if h.records[record.SourceID] == nil {
+			h.records[record.SourceID] = make(map[string]*EntryRecord)
+		}
+		h.records[record.SourceID][record.Entry.ID] = &record
+	}
+}
+
+// prune applies the retention policy and returns how many entries were dropped
+func (h *entryHistory) prune(policy RetentionPolicy, now time.Time) int {
+	dropped := 0
+
+	if policy.MaxAge > 0 {
+		cutoff := now.Add(-policy.MaxAge)
+		for _, records := range h.records {
+			for id, record := range records {
+				if !record.InFeed && record.LastSeen.Before(cutoff) {
+					delete(records, id)
+					dropped++
+				}
+			}
+		}
+	}
+
+	if policy.MaxPerSource > 0 {
+		for sourceID, records := range h.records {
+			if len(records) <= policy.MaxPerSource {
+				continue
+			}
+			dropped += h.dropBeyond(h.sourceRecords(sourceID), policy.MaxPerSource)
+		}
+	}
+
+	if policy.MaxEntries > 0 {
+		if all := h.all(); len(all) > policy.MaxEntries {
+			dropped += h.dropBeyond(all, policy.MaxEntries)
+		}
+	}
+
+	return dropped
+}
+
+// dropBeyond drops the records after the first limit ones, newest first,
+// that are no longer in their source feed, and returns how many it dropped
+func (h *entryHistory) dropBeyond(records []EntryRecord, limit int) int {
+	dropped := 0
+	for _, record := range records[limit:] {
+		if record.InFeed {
+			continue
+		}
+		delete(h.records[record.SourceID], record.Entry.ID)
+		dropped++
+	}
+	return dropped
+}
+
+// sortRecords orders records by publication date, newest first
+func sortRecords(records []EntryRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Entry.Published.Equal(records[j].Entry.Published) {
+			return records[i].Entry.Published.After(records[j].Entry.Published)
+		}
+		return records[i].Entry.ID < records[j].Entry.ID
+	})
+}
+
+// SetRetentionPolicy sets how much entry history the aggregator keeps.
+// The policy is applied after every fetch.
+func (a *Aggregator) SetRetentionPolicy(policy RetentionPolicy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.retention = policy
+}
+
+// EntryHistory returns every entry the aggregator remembers, newest first,
+// including entries that are no longer in their source feed
+func (a *Aggregator) EntryHistory() []EntryRecord {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.history.all()
+}
+
+// SourceHistory returns the entries remembered for one source, newest first
+func (a *Aggregator) SourceHistory(sourceID string) []EntryRecord {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.history.sourceRecords(sourceID)
+}
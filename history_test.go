@@ -0,0 +1,36 @@
+package beam
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testEntries returns n entries, the first one the newest
+func testEntries(n int) []Entry {
+	now := time.Now()
+	entries := make([]Entry, n)
+	for i := range entries {
+		id := fmt.Sprint(i)
+		entries[i] = NewEntry(id, "Entry "+id, "https://example.com/"+id, now.Add(-time.Duration(i)*time.Hour))
+	}
+	return entries
+}
+
+func TestPruneKeepsEntriesInFeed(t *testing.T) {
+	h := newEntryHistory()
+	h.observe("src", testEntries(5), time.Now())
+
+	if dropped := h.prune(RetentionPolicy{MaxPerSource: 3, MaxEntries: 2}, time.Now()); dropped != 0 {
+		t.Fatalf("dropped %d entries still in the feed", dropped)
+	}
+
+	// Entries rotated out of the feed are dropped beyond the limit
+	h.observe("src", testEntries(2), time.Now())
+	if dropped := h.prune(RetentionPolicy{MaxPerSource: 3}, time.Now()); dropped != 2 {
+		t.Fatalf("dropped %d entries, want 2", dropped)
+	}
+	if got := len(h.sourceRecords("src")); got != 3 {
+		t.Fatalf("kept %d entries, want 3", got)
+	}
+}
@@ -0,0 +1,491 @@
+package beam
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxHubSecretLength is the longest hub.secret WebSub allows
+const maxHubSecretLength = 200
+
+// HubSubscription is a subscriber's subscription to a topic on a Hub
+type HubSubscription struct {
+	Topic     string    `json:"topic"`
+	Callback  string    `json:"callback"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Expires   time.Time `json:"expires"`
+}
+
+// HubStore persists the subscriptions of a Hub
+type HubStore interface {
+	// Put adds a subscription, replacing any of the same callback to the same topic
+	Put(sub HubSubscription) error
+	// Delete removes the subscription of a callback to a topic, if any
+	Delete(topic, callback string) error
+	// List returns the subscriptions to a topic, including expired ones
+	List(topic string) ([]HubSubscription, error)
+}
+
+// MemoryHubStore is a HubStore that keeps subscriptions in memory
+type MemoryHubStore struct {
+	mu   sync.Mutex
+	subs map[string]map[string]HubSubscription // topic -> callback -> subscription
+}
+
+// NewMemoryHubStore creates an empty in-memory hub store
+func NewMemoryHubStore() *MemoryHubStore {
+	return &MemoryHubStore{subs: make(map[string]map[string]HubSubscription)}
+}
+
+// Put implements HubStore
+func (s *MemoryHubStore) Put(sub HubSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.subs[sub.Topic] == nil {
+		s.subs[sub.Topic] = make(map[string]HubSubscription)
+	}
+	s.subs[sub.Topic][sub.Callback] = sub
+	return nil
+}
+
+// Delete implements HubStore
+func (s *MemoryHubStore) Delete(topic, callback string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subs[topic], callback)
+	if len(s.subs[topic]) == 0 {
+		delete(s.subs, topic)
+	}
+	return nil
+}
+
+// List implements HubStore
+func (s *MemoryHubStore) List(topic string) ([]HubSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := make([]HubSubscription, 0, len(s.subs[topic]))
+	for _, sub := range s.subs[topic] {
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// FileHubStore is a HubStore that keeps subscriptions in a JSON file,
+// rewritten atomically on every change
+type FileHubStore struct {
+	path   string
+	memory *MemoryHubStore
+	mu     sync.Mutex
+}
+
+// NewFileHubStore creates a hub store backed by the file at path, loading
+// the subscriptions already saved in it
+func NewFileHubStore(path string) (*FileHubStore, error) {
+	s := &FileHubStore{path: path, memory: NewMemoryHubStore()}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions: %w", err)
+	}
+
+	var subs []HubSubscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("failed to parse subscriptions: %w", err)
+	}
+	for _, sub := range subs {
+		s.memory.Put(sub)
+	}
+	return s, nil
+}
+
+// Put implements HubStore
+func (s *FileHubStore) Put(sub HubSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.memory.Put(sub)
+	return s.saveLocked()
+}
+
+// Delete implements HubStore
+func (s *FileHubStore) Delete(topic, callback string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.memory.Delete(topic, callback)
+	return s.saveLocked()
+}
+
+// List implements HubStore
+func (s *FileHubStore) List(topic string) ([]HubSubscription, error) {
+	return s.memory.List(topic)
+}
+
+// saveLocked writes every subscription to the file.
+// The caller must hold s.mu.
+func (s *FileHubStore) saveLocked() error {
+	s.memory.mu.Lock()
+	var subs []HubSubscription
+	for _, callbacks := range s.memory.subs {
+		for _, sub := range callbacks {
+			subs = append(subs, sub)
+		}
+	}
+	s.memory.mu.Unlock()
+
+	data, err := json.Marshal(subs)
+	if err != nil {
+		return fmt.Errorf("failed to encode subscriptions: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write subscriptions: %w", err)
+	}
+	return nil
+}
+
+// Hub is an embeddable WebSub hub. Mounted at its public URL, it accepts
+// subscription requests, verifies the subscriber's intent, and when a
+// publisher pings it fetches the topic and delivers the content to every
+// subscriber, signed with the subscriber's secret.
+//
+// The hub serves no topics until SetTopicFilter names the publisher's own
+// feeds, so it cannot be used to fetch arbitrary URLs from the server.
+type Hub struct {
+	url            string
+	store          HubStore
+	client         *http.Client
+	defaultLease   time.Duration
+	maxLease       time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+	allowTopic     func(topic string) bool
+
+	mu      sync.Mutex
+	digests map[string][sha256.Size]byte // topic -> digest of the last delivered content
+	wg      sync.WaitGroup
+}
+
+// NewHub creates a hub served at hubURL that keeps subscriptions in store
+func NewHub(hubURL string, store HubStore) *Hub {
+	return &Hub{
+		url:            hubURL,
+		store:          store,
+		client:         &http.Client{Timeout: 30 * time.Second},
+		defaultLease:   7 * 24 * time.Hour,
+		maxLease:       30 * 24 * time.Hour,
+		maxAttempts:    3,
+		initialBackoff: time.Second,
+		digests:        make(map[string][sha256.Size]byte),
+	}
+}
+
+// SetLeaseLimits sets the lease granted when a subscriber asks for none and
+// the longest lease granted
+func (h *Hub) SetLeaseLimits(defaultLease, maxLease time.Duration) {
+	h.defaultLease, h.maxLease = defaultLease, maxLease
+}
+
+// SetTopicFilter sets the topics the hub accepts subscriptions and pings
+// for. Requests for other topics are denied, as are all requests while no
+// filter is set.
+func (h *Hub) SetTopicFilter(allow func(topic string) bool) {
+	h.allowTopic = allow
+}
+
+// servesTopic reports whether the topic filter allows topic
+func (h *Hub) servesTopic(topic string) bool {
+	return h.allowTopic != nil && h.allowTopic(topic)
+}
+
+// Wait blocks until all pending verifications and deliveries have finished
+func (h *Hub) Wait() {
+	h.wg.Wait()
+}
+
+// ServeHTTP implements http.Handler for subscription requests and
+// publisher pings, both sent as form-encoded POSTs
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	switch mode := r.PostForm.Get("hub.mode"); mode {
+	case "subscribe", "unsubscribe":
+		h.handleSubscription(w, r, mode)
+	case "publish":
+		h.handlePublish(w, r)
+	default:
+		http.Error(w, "Unsupported hub.mode", http.StatusBadRequest)
+	}
+}
+
+// handleSubscription validates a subscription request and verifies the
+// subscriber's intent in the background
+func (h *Hub) handleSubscription(w http.ResponseWriter, r *http.Request, mode string) {
+	topic, callback := r.PostForm.Get("hub.topic"), r.PostForm.Get("hub.callback")
+	secret := r.PostForm.Get("hub.secret")
+
+	switch {
+	case !isValidURL(topic):
+		http.Error(w, "hub.topic must be a valid URL", http.StatusBadRequest)
+		return
+	case !isValidURL(callback):
+		http.Error(w, "hub.callback must be a valid URL", http.StatusBadRequest)
+		return
+	case len(secret) > maxHubSecretLength:
+		http.Error(w, "hub.secret is too long", http.StatusBadRequest)
+		return
+	}
+
+	lease := h.defaultLease
+	if seconds, err := strconv.Atoi(r.PostForm.Get("hub.lease_seconds")); err == nil && seconds > 0 {
+		lease = min(time.Duration(seconds)*time.Second, h.maxLease)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		if !h.servesTopic(topic) {
+			h.deny(topic, callback, "topic not served by this hub")
+			return
+		}
+		if err := h.verifyIntent(mode, topic, callback, lease); err != nil {
+			fmt.Printf("Hub: %s of %s to %s not verified: %v\n", mode, callback, topic, err)
+			return
+		}
+
+		var err error
+		if mode == "subscribe" {
+			now := time.Now()
+			err = h.store.Put(HubSubscription{
+				Topic:     topic,
+				Callback:  callback,
+				Secret:    secret,
+				CreatedAt: now,
+				Expires:   now.Add(lease),
+			})
+		} else {
+			err = h.store.Delete(topic, callback)
+		}
+		if err != nil {
+			fmt.Printf("Hub: failed to store %s of %s: %v\n", mode, callback, err)
+		}
+	}()
+}
+
+// verifyIntent asks the subscriber to confirm a request by echoing a challenge
+func (h *Hub) verifyIntent(mode, topic, callback string, lease time.Duration) error {
+	challenge := randomID()
+	query := url.Values{
+		"hub.mode":      {mode},
+		"hub.topic":     {topic},
+		"hub.challenge": {challenge},
+	}
+	if mode == "subscribe" {
+		query.Set("hub.lease_seconds", strconv.Itoa(int(lease.Seconds())))
+	}
+
+	resp, err := h.client.Get(withQueryValues(callback, query))
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return fmt.Errorf("read error: %w", err)
+	}
+	if string(bytes.TrimSpace(body)) != challenge {
+		return errors.New("challenge mismatch")
+	}
+	return nil
+}
+
+// deny tells a subscriber that its subscription was refused
+func (h *Hub) deny(topic, callback, reason string) {
+	resp, err := h.client.Get(withQueryValues(callback, url.Values{
+		"hub.mode":   {"denied"},
+		"hub.topic":  {topic},
+		"hub.reason": {reason},
+	}))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// handlePublish accepts a publisher ping for one or more topics, given as
+// hub.url or hub.topic, and distributes them in the background
+func (h *Hub) handlePublish(w http.ResponseWriter, r *http.Request) {
+	topics := append(r.PostForm["hub.url"], r.PostForm["hub.topic"]...)
+	if len(topics) == 0 {
+		http.Error(w, "hub.url is required", http.StatusBadRequest)
+		return
+	}
+	for _, topic := range topics {
+		if !isValidURL(topic) || !h.servesTopic(topic) {
+			http.Error(w, fmt.Sprintf("topic not served by this hub: %s", topic), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	for _, topic := range topics {
+		h.wg.Add(1)
+		go func(topic string) {
+			defer h.wg.Done()
+			if err := h.Publish(topic); err != nil {
+				fmt.Printf("Hub: failed to publish %s: %v\n", topic, err)
+			}
+		}(topic)
+	}
+}
+
+// Publish fetches a topic and delivers its content to the topic's current
+// subscribers, unless it is unchanged since the last delivery. Expired
+// subscriptions are removed, and a topic without subscribers is not
+// fetched. Deliveries run in the background.
+func (h *Hub) Publish(topic string) error {
+	subs, err := h.store.List(topic)
+	if err != nil {
+		return fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	now := time.Now()
+	active := subs[:0]
+	for _, sub := range subs {
+		if sub.Expires.Before(now) {
+			h.store.Delete(sub.Topic, sub.Callback)
+			continue
+		}
+		active = append(active, sub)
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	resp, err := h.client.Get(topic)
+	if err != nil {
+		return fmt.Errorf("failed to fetch topic: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPushSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read topic: %w", err)
+	}
+	if len(body) > maxPushSize {
+		return fmt.Errorf("topic is larger than %d bytes", maxPushSize)
+	}
+
+	digest := sha256.Sum256(body)
+	h.mu.Lock()
+	unchanged := h.digests[topic] == digest
+	h.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	for _, sub := range active {
+		h.wg.Add(1)
+		go func(sub HubSubscription) {
+			defer h.wg.Done()
+			h.deliver(sub, contentType, body)
+		}(sub)
+	}
+
+	h.mu.Lock()
+	h.digests[topic] = digest
+	h.mu.Unlock()
+	return nil
+}
+
+// deliver POSTs content to a subscriber, retrying with backoff on failure.
+// A 410 Gone response ends the subscription.
+func (h *Hub) deliver(sub HubSubscription, contentType string, body []byte) {
+	backoff := h.initialBackoff
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, sub.Callback, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, h.url))
+		req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="self"`, sub.Topic))
+		if sub.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(sub.Secret))
+			mac.Write(body)
+			req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		resp, err := h.client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			switch {
+			case resp.StatusCode >= 200 && resp.StatusCode < 300:
+				return
+			case resp.StatusCode == http.StatusGone:
+				h.store.Delete(sub.Topic, sub.Callback)
+				return
+			}
+			err = fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+		}
+
+		if attempt >= h.maxAttempts {
+			fmt.Printf("Hub: delivery of %s to %s failed: %v\n", sub.Topic, sub.Callback, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// withQueryValues returns rawURL with the given query parameters added
+func withQueryValues(rawURL string, values url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, list := range values {
+		query[key] = list
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
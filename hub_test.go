@@ -0,0 +1,274 @@
+package beam
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSubscriber is a WebSub subscriber callback recording what the hub
+// sends it
+type testSubscriber struct {
+	mu           sync.Mutex
+	verification url.Values // query of the last intent verification or denial
+	deliveries   []*http.Request
+	bodies       []string
+	failures     int // deliveries answered with 500 before accepting
+}
+
+func (s *testSubscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		s.verification = r.URL.Query()
+		w.Write([]byte(r.URL.Query().Get("hub.challenge")))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	s.deliveries = append(s.deliveries, r)
+	s.bodies = append(s.bodies, string(body))
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// received returns the last verification query and the deliveries so far
+func (s *testSubscriber) received() (url.Values, []*http.Request, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.verification, s.deliveries, s.bodies
+}
+
+// newTestHub returns a hub serving topic, mounted on a test server
+func newTestHub(t *testing.T, topic string) (*Hub, *httptest.Server) {
+	t.Helper()
+	hub := NewHub("", NewMemoryHubStore())
+	hub.SetTopicFilter(func(t string) bool { return t == topic })
+	hub.initialBackoff = time.Millisecond
+	server := httptest.NewServer(hub)
+	hub.url = server.URL
+	t.Cleanup(server.Close)
+	return hub, server
+}
+
+// subscribe sends a subscription request to the hub and waits for its
+// verification
+func subscribe(t *testing.T, hub *Hub, server *httptest.Server, form url.Values) {
+	t.Helper()
+	form.Set("hub.mode", "subscribe")
+	resp, err := http.PostForm(server.URL, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("subscription answered %d, want 202", resp.StatusCode)
+	}
+	hub.Wait()
+}
+
+func TestHubSubscribeVerifiesIntent(t *testing.T) {
+	subscriber := &testSubscriber{}
+	callback := httptest.NewServer(subscriber)
+	defer callback.Close()
+
+	topic := "https://example.com/feed"
+	hub, server := newTestHub(t, topic)
+	hub.SetLeaseLimits(time.Hour, 2*time.Hour)
+	subscribe(t, hub, server, url.Values{
+		"hub.topic":         {topic},
+		"hub.callback":      {callback.URL},
+		"hub.lease_seconds": {"999999"},
+	})
+
+	verification, _, _ := subscriber.received()
+	if mode := verification.Get("hub.mode"); mode != "subscribe" {
+		t.Fatalf("verification hub.mode = %q, want subscribe", mode)
+	}
+	if lease := verification.Get("hub.lease_seconds"); lease != "7200" {
+		t.Fatalf("verification hub.lease_seconds = %q, want the maximum of 7200", lease)
+	}
+	subs, _ := hub.store.List(topic)
+	if len(subs) != 1 || subs[0].Callback != callback.URL {
+		t.Fatalf("subscriptions = %+v, want one for the callback", subs)
+	}
+	if lease := time.Until(subs[0].Expires); lease > 2*time.Hour || lease < time.Hour {
+		t.Fatalf("subscription expires in %s, want 2h", lease)
+	}
+}
+
+func TestHubSubscribeNotStoredWithoutIntent(t *testing.T) {
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("wrong"))
+	}))
+	defer callback.Close()
+
+	topic := "https://example.com/feed"
+	hub, server := newTestHub(t, topic)
+	subscribe(t, hub, server, url.Values{"hub.topic": {topic}, "hub.callback": {callback.URL}})
+
+	if subs, _ := hub.store.List(topic); len(subs) != 0 {
+		t.Fatalf("unverified subscription stored: %+v", subs)
+	}
+}
+
+func TestHubDeniesTopics(t *testing.T) {
+	subscriber := &testSubscriber{}
+	callback := httptest.NewServer(subscriber)
+	defer callback.Close()
+
+	hub, server := newTestHub(t, "https://example.com/feed")
+	other := "https://example.com/other"
+	subscribe(t, hub, server, url.Values{"hub.topic": {other}, "hub.callback": {callback.URL}})
+	verification, _, _ := subscriber.received()
+	if mode := verification.Get("hub.mode"); mode != "denied" {
+		t.Fatalf("callback got hub.mode %q, want denied", mode)
+	}
+	if subs, _ := hub.store.List(other); len(subs) != 0 {
+		t.Fatalf("denied subscription stored: %+v", subs)
+	}
+
+	resp, err := http.PostForm(server.URL, url.Values{"hub.mode": {"publish"}, "hub.url": {other}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("ping for a denied topic answered %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestHubWithoutTopicFilterServesNothing(t *testing.T) {
+	var fetches atomic.Int32
+	topic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+	}))
+	defer topic.Close()
+
+	server := httptest.NewServer(NewHub("https://example.com/hub", NewMemoryHubStore()))
+	defer server.Close()
+
+	resp, err := http.PostForm(server.URL, url.Values{"hub.mode": {"publish"}, "hub.url": {topic.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("ping answered %d, want 400", resp.StatusCode)
+	}
+	if fetches.Load() != 0 {
+		t.Fatal("hub fetched a topic it does not serve")
+	}
+}
+
+func TestHubPublishDeduplicatesByDigest(t *testing.T) {
+	var content atomic.Value
+	content.Store("first")
+	var fetches atomic.Int32
+	topicServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", ContentTypeJSONFeed)
+		w.Write([]byte(content.Load().(string)))
+	}))
+	defer topicServer.Close()
+	topic := topicServer.URL
+
+	hub, _ := newTestHub(t, topic)
+
+	// Without subscribers the topic is not fetched
+	if err := hub.Publish(topic); err != nil {
+		t.Fatal(err)
+	}
+	if fetches.Load() != 0 {
+		t.Fatal("topic fetched without subscribers")
+	}
+
+	subscriber := &testSubscriber{}
+	callback := httptest.NewServer(subscriber)
+	defer callback.Close()
+	hub.store.Put(HubSubscription{Topic: topic, Callback: callback.URL, Expires: time.Now().Add(time.Hour)})
+
+	for _, body := range []string{"first", "first", "second"} {
+		content.Store(body)
+		if err := hub.Publish(topic); err != nil {
+			t.Fatal(err)
+		}
+		hub.Wait()
+	}
+
+	_, deliveries, bodies := subscriber.received()
+	if got := strings.Join(bodies, " "); got != "first second" {
+		t.Fatalf("delivered %q, want \"first second\"", got)
+	}
+	if contentType := deliveries[0].Header.Get("Content-Type"); contentType != ContentTypeJSONFeed {
+		t.Fatalf("delivered Content-Type %q, want %q", contentType, ContentTypeJSONFeed)
+	}
+}
+
+func TestHubPublishRetriesSignedDeliveries(t *testing.T) {
+	topicServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer topicServer.Close()
+	topic := topicServer.URL
+
+	hub, _ := newTestHub(t, topic)
+	subscriber := &testSubscriber{failures: 1}
+	callback := httptest.NewServer(subscriber)
+	defer callback.Close()
+	hub.store.Put(HubSubscription{Topic: topic, Callback: callback.URL, Secret: "secret", Expires: time.Now().Add(time.Hour)})
+
+	if err := hub.Publish(topic); err != nil {
+		t.Fatal(err)
+	}
+	hub.Wait()
+
+	_, deliveries, bodies := subscriber.received()
+	if len(deliveries) != 2 {
+		t.Fatalf("%d delivery attempts, want 2", len(deliveries))
+	}
+	for i, req := range deliveries {
+		if !verifyHubSignature("secret", []byte(bodies[i]), req.Header.Get("X-Hub-Signature")) {
+			t.Fatalf("attempt %d has invalid signature %q", i+1, req.Header.Get("X-Hub-Signature"))
+		}
+	}
+}
+
+func TestHubPublishRemovesExpiredSubscriptions(t *testing.T) {
+	var fetches atomic.Int32
+	topicServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte("content"))
+	}))
+	defer topicServer.Close()
+	topic := topicServer.URL
+
+	hub, _ := newTestHub(t, topic)
+	subscriber := &testSubscriber{}
+	callback := httptest.NewServer(subscriber)
+	defer callback.Close()
+	hub.store.Put(HubSubscription{Topic: topic, Callback: callback.URL, Expires: time.Now().Add(-time.Minute)})
+
+	if err := hub.Publish(topic); err != nil {
+		t.Fatal(err)
+	}
+	hub.Wait()
+
+	if subs, _ := hub.store.List(topic); len(subs) != 0 {
+		t.Fatalf("expired subscription kept: %+v", subs)
+	}
+	if _, deliveries, _ := subscriber.received(); len(deliveries) != 0 || fetches.Load() != 0 {
+		t.Fatal("content fetched or delivered for an expired subscription")
+	}
+}
@@ -0,0 +1,189 @@
+package beam
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ImageInfo describes an image with what readers need to show it as a
+// thumbnail
+type ImageInfo struct {
+	URL      string `json:"url"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Alt      string `json:"alt,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// minFeaturedImageSize is the smallest width or height, in pixels, of an
+// image that ExtractImage picks; smaller ones are icons, emoji and
+// tracking pixels
+const minFeaturedImageSize = 50
+
+// ExtractImage returns the first meaningful image of HTML content: the
+// first <img> with an http or https URL that is not declared smaller than
+// 50 pixels, is not an emoji, and is not inside a script or other dropped
+// element. Relative URLs are resolved against baseURL, if it is set. The
+// MIME type is guessed from the file extension.
+func ExtractImage(content, baseURL string) (ImageInfo, bool) {
+	s := sanitizer{
+		content: content,
+		schemes: map[string]bool{"http": true, "https": true},
+		base:    parseBaseURL(baseURL),
+	}
+	for s.pos < len(s.content) {
+		lt := strings.IndexByte(s.content[s.pos:], '<')
+		if lt < 0 {
+			break
+		}
+		s.pos += lt
+
+		rest := s.content[s.pos:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			s.skipPast("-->")
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			s.skipPast(">")
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			tag := s.readTag()
+			if droppedElements[tag.name] && !voidElements[tag.name] {
+				s.skipElement(tag.name)
+			} else if tag.name == "img" {
+				if info, ok := s.imageInfo(tag); ok {
+					return info, true
+				}
+			}
+		default:
+			s.pos++
+		}
+	}
+	return ImageInfo{}, false
+}
+
+// imageInfo returns the image of an <img> tag, if it is meaningful
+func (s *sanitizer) imageInfo(tag htmlTag) (ImageInfo, bool) {
+	var info ImageInfo
+	var src, lazySrc string
+	for _, attr := range tag.attrs {
+		switch name, value := attr[0], attr[1]; name {
+		case "src":
+			src = value
+		case "data-src":
+			lazySrc = value
+		case "alt":
+			info.Alt = strings.TrimSpace(value)
+		case "width":
+			info.Width = parsePixels(value)
+		case "height":
+			info.Height = parsePixels(value)
+		case "class":
+			if strings.Contains(value, "emoji") || strings.Contains(value, "smiley") {
+				return ImageInfo{}, false
+			}
+		}
+	}
+	if (info.Width > 0 && info.Width < minFeaturedImageSize) || (info.Height > 0 && info.Height < minFeaturedImageSize) {
+		return ImageInfo{}, false
+	}
+
+	// Lazily loaded images keep a placeholder in src
+	if lazySrc != "" && (src == "" || strings.HasPrefix(strings.TrimSpace(src), "data:")) {
+		src = lazySrc
+	}
+	if strings.TrimSpace(src) == "" {
+		return ImageInfo{}, false
+	}
+	imageURL, ok := s.sanitizeURL(src)
+	if !ok || !isValidURL(imageURL) {
+		return ImageInfo{}, false
+	}
+	info.URL = imageURL
+	info.MIMEType = imageMIMEType(imageURL)
+	return info, true
+}
+
+// parsePixels parses a width or height attribute, returning 0 if it is not
+// a number of pixels
+func parsePixels(value string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "px"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// imageMIMEType guesses the MIME type of an image from the extension of
+// its URL, returning "" if it is not a known image type
+func imageMIMEType(imageURL string) string {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return ""
+	}
+	mimeType := mime.TypeByExtension(strings.ToLower(path.Ext(u.Path)))
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ""
+	}
+	return mimeType
+}
+
+// mediaContent is the Media RSS content element, which RSS and Atom
+// readers take thumbnails from
+type mediaContent struct {
+	URL         string `xml:"url,attr"`
+	Type        string `xml:"type,attr,omitempty"`
+	Medium      string `xml:"medium,attr,omitempty"`
+	Width       int    `xml:"width,attr,omitempty"`
+	Height      int    `xml:"height,attr,omitempty"`
+	Description string `xml:"http://search.yahoo.com/mrss/ description,omitempty"`
+}
+
+// mediaThumbnail is the Media RSS thumbnail element
+type mediaThumbnail struct {
+	URL    string `xml:"url,attr"`
+	Width  int    `xml:"width,attr,omitempty"`
+	Height int    `xml:"height,attr,omitempty"`
+}
+
+// mediaElements converts the featured image of an entry to Media RSS
+// elements, or nil if it has none
+func mediaElements(entry Entry) (*mediaContent, *mediaThumbnail) {
+	info, ok := entry.FeaturedImage()
+	if !ok {
+		return nil, nil
+	}
+	content := &mediaContent{
+		URL:         info.URL,
+		Type:        info.MIMEType,
+		Medium:      "image",
+		Width:       info.Width,
+		Height:      info.Height,
+		Description: info.Alt,
+	}
+	return content, &mediaThumbnail{URL: info.URL, Width: info.Width, Height: info.Height}
+}
+
+// fromMediaElements sets the featured image of an entry from Media RSS
+// elements: an image content element, or else the thumbnail
+func fromMediaElements(entry *Entry, content []mediaContent, thumbnail *mediaThumbnail) {
+	for _, element := range content {
+		if element.Medium != "image" && !strings.HasPrefix(element.Type, "image/") {
+			continue
+		}
+		if isValidURL(element.URL) {
+			entry.SetImageInfo(ImageInfo{
+				URL:      element.URL,
+				Width:    element.Width,
+				Height:   element.Height,
+				Alt:      element.Description,
+				MIMEType: element.Type,
+			})
+			return
+		}
+	}
+	if thumbnail != nil && isValidURL(thumbnail.URL) {
+		entry.SetImageInfo(ImageInfo{URL: thumbnail.URL, Width: thumbnail.Width, Height: thumbnail.Height})
+	}
+}
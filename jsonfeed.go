@@ -0,0 +1,185 @@
+package beam
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JSONFeedVersion is the JSON Feed specification version produced by ToJSONFeed
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// jsonFeed is the JSON Feed 1.1 document structure
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	NextURL     string           `json:"next_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Hubs        []jsonFeedHub    `json:"hubs,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+	Tombstones  []Tombstone      `json:"_tombstones,omitempty"` // extension listing deleted items
+}
+
+// jsonFeedHub is a JSON Feed hub object
+type jsonFeedHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// jsonFeedAuthor is a JSON Feed author object
+type jsonFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// jsonFeedItem is a JSON Feed item object
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished *time.Time       `json:"date_published,omitempty"`
+	DateModified  *time.Time       `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Attachments   []Attachment     `json:"attachments,omitempty"`
+}
+
+// ToJSONFeed serializes the feed as a JSON Feed 1.1 document
+func (f *Feed) ToJSONFeed() ([]byte, error) {
+	doc := jsonFeed{
+		Version:     JSONFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.HomePageURL,
+		FeedURL:     f.FeedURL,
+		NextURL:     olderPageURL(f),
+		Description: f.Description,
+		Language:    f.Language,
+		Authors:     jsonFeedAuthors(f.Author),
+		Items:       make([]jsonFeedItem, 0, len(f.Items)),
+		Tombstones:  f.Tombstones,
+	}
+	if f.Hub != "" {
+		doc.Hubs = []jsonFeedHub{{Type: "WebSub", URL: f.Hub}}
+	}
+
+	for _, entry := range f.Items {
+		published := entry.Published
+		item := jsonFeedItem{
+			ID:            entry.ID,
+			URL:           entry.URL,
+			Title:         entry.Title,
+			ContentHTML:   entry.Content,
+			Summary:       entry.Summary,
+			Image:         entry.Image,
+			DatePublished: &published,
+			DateModified:  entry.Updated,
+			Authors:       jsonFeedAuthors(entry.Author),
+			Tags:          entryTerms(entry),
+			Attachments:   entry.Attachments,
+		}
+		doc.Items = append(doc.Items, item)
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// jsonFeedAuthors converts a BEAM author to a JSON Feed authors list
+func jsonFeedAuthors(author *Author) []jsonFeedAuthor {
+	if author == nil || (author.Name == "" && author.URL == "") {
+		return nil
+	}
+	return []jsonFeedAuthor{{Name: author.Name, URL: author.URL}}
+}
+
+// entryTerms returns the entry category followed by its tags, for formats
+// that have a single list of terms
+func entryTerms(entry Entry) []string {
+	if entry.Category == "" {
+		return entry.Tags
+	}
+	terms := make([]string, 0, len(entry.Tags)+1)
+	terms = append(terms, entry.Category)
+	return append(terms, entry.Tags...)
+}
+
+// fromJSONFeed converts a JSON Feed document into a BEAM feed.
+// Items without a usable ID, URL or date are skipped.
+func fromJSONFeed(data []byte) (*Feed, error) {
+	var doc jsonFeed
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON Feed: %w", err)
+	}
+
+	feed := NewFeed(doc.Title, doc.FeedURL)
+	feed.Description = doc.Description
+	feed.HomePageURL = doc.HomePageURL
+	feed.NextURL = doc.NextURL
+	feed.Language = doc.Language
+	if len(doc.Authors) > 0 {
+		feed.Author = &Author{Name: doc.Authors[0].Name, URL: doc.Authors[0].URL}
+	}
+	for _, hub := range doc.Hubs {
+		if strings.EqualFold(hub.Type, "WebSub") && feed.Hub == "" {
+			feed.Hub = hub.URL
+		}
+	}
+
+	for _, item := range doc.Items {
+		id := item.ID
+		if id == "" {
+			id = item.URL
+		}
+
+		var published time.Time
+		if item.DatePublished != nil {
+			published = *item.DatePublished
+		} else if item.DateModified != nil {
+			published = *item.DateModified
+		}
+
+		title := item.Title
+		if title == "" {
+			title = item.URL
+		}
+
+		entry := NewEntry(id, title, item.URL, published)
+		entry.Summary = item.Summary
+		entry.Image = item.Image
+		if item.ContentHTML != "" {
+			entry.SetContent(item.ContentHTML)
+		}
+		if item.DateModified != nil {
+			entry.SetUpdated(*item.DateModified)
+		}
+		if len(item.Authors) > 0 {
+			entry.Author = &Author{Name: item.Authors[0].Name, URL: item.Authors[0].URL}
+		}
+		if len(item.Tags) > 0 {
+			entry.Tags = item.Tags
+		}
+		for _, attachment := range item.Attachments {
+			if attachment.Validate() == nil {
+				entry.Attachments = append(entry.Attachments, attachment)
+			}
+		}
+		if entry.Validate() != nil {
+			continue
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+	for _, tombstone := range doc.Tombstones {
+		if tombstone.ID != "" {
+			feed.Tombstones = append(feed.Tombstones, tombstone)
+		}
+	}
+
+	return feed, nil
+}
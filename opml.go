@@ -0,0 +1,184 @@
+package beam
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// opmlDocument is the OPML 2.0 document structure
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+// opmlHead is the OPML head element
+type opmlHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+// opmlBody is the OPML body element
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlOutline is an OPML outline element. Outlines with an xmlUrl are
+// subscriptions; outlines without one are folders. The status, lastFetch
+// and error attributes are beam-go additions describing the source state.
+type opmlOutline struct {
+	Text        string        `xml:"text,attr"`
+	Title       string        `xml:"title,attr,omitempty"`
+	Type        string        `xml:"type,attr,omitempty"`
+	XMLURL      string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL     string        `xml:"htmlUrl,attr,omitempty"`
+	Description string        `xml:"description,attr,omitempty"`
+	Category    string        `xml:"category,attr,omitempty"`
+	Status      string        `xml:"status,attr,omitempty"`
+	LastFetch   string        `xml:"lastFetch,attr,omitempty"`
+	Error       string        `xml:"error,attr,omitempty"`
+	Outlines    []opmlOutline `xml:"outline"`
+}
+
+// ImportOPML adds the subscriptions listed in an OPML document as sources.
+// Nested folder outlines become the source group, joined with "/", and the
+// category attribute becomes the source tags. Subscriptions whose feed URL
+// is already a source are skipped. It returns the number of sources added.
+func (a *Aggregator) ImportOPML(r io.Reader) (int, error) {
+	var doc opmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return 0, fmt.Errorf("failed to parse OPML: %w", err)
+	}
+
+	var sources []FeedSource
+	collectOPMLSources(doc.Body.Outlines, nil, &sources)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	added := 0
+	for _, src := range sources {
+		if _, err := a.addSourceLocked(src); err != nil {
+			continue
+		}
+		added++
+		a.publishSourceEvent(EventSourceAdded, a.Sources[len(a.Sources)-1], nil)
+	}
+
+	fmt.Printf("Imported %d sources from OPML\n", added)
+	a.persistLocked()
+	return added, nil
+}
+
+// collectOPMLSources walks nested outlines, turning subscriptions into sources
+func collectOPMLSources(outlines []opmlOutline, folders []string, sources *[]FeedSource) {
+	for _, outline := range outlines {
+		name := outline.Title
+		if name == "" {
+			name = outline.Text
+		}
+
+		if outline.XMLURL == "" {
+			collectOPMLSources(outline.Outlines, append(folders, name), sources)
+			continue
+		}
+		if !isValidURL(outline.XMLURL) {
+			continue
+		}
+		if name == "" {
+			name = outline.XMLURL
+		}
+
+		src := FeedSource{
+			URL:         outline.XMLURL,
+			HomePageURL: outline.HTMLURL,
+			Name:        name,
+			Description: outline.Description,
+			Group:       strings.Join(folders, "/"),
+			Tags:        opmlCategories(outline.Category),
+		}
+		if outline.Status == "disabled" {
+			src.Disabled, src.Status = true, "disabled"
+		}
+		*sources = append(*sources, src)
+	}
+}
+
+// ExportOPML writes the aggregator's sources as an OPML 2.0 document.
+// Sources are nested in folder outlines following their group, and each
+// subscription carries its current status, last fetch time and error.
+func (a *Aggregator) ExportOPML(w io.Writer) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	doc := opmlDocument{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       a.AggregatedFeed.Title,
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, src := range a.Sources {
+		outline := opmlOutline{
+			Text:        src.Name,
+			Title:       src.Name,
+			Type:        "rss",
+			XMLURL:      src.URL,
+			HTMLURL:     src.HomePageURL,
+			Description: src.Description,
+			Category:    strings.Join(src.Tags, ","),
+			Status:      src.Status,
+			Error:       src.ErrorMsg,
+		}
+		if !src.LastFetch.IsZero() {
+			outline.LastFetch = src.LastFetch.UTC().Format(time.RFC3339)
+		}
+
+		folder := &doc.Body.Outlines
+		if src.Group != "" {
+			for _, name := range strings.Split(src.Group, "/") {
+				folder = opmlFolder(folder, name)
+			}
+		}
+		*folder = append(*folder, outline)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write OPML: %w", err)
+	}
+	return encoder.Close()
+}
+
+// opmlFolder returns the child outlines of the folder named name,
+// creating the folder if it does not exist yet
+func opmlFolder(outlines *[]opmlOutline, name string) *[]opmlOutline {
+	for i := range *outlines {
+		if (*outlines)[i].XMLURL == "" && (*outlines)[i].Text == name {
+			return &(*outlines)[i].Outlines
+		}
+	}
+	*outlines = append(*outlines, opmlOutline{Text: name, Title: name})
+	return &(*outlines)[len(*outlines)-1].Outlines
+}
+
+// opmlCategories splits an OPML category attribute into tags.
+// Categories are comma separated, with a leading slash marking a path.
+func opmlCategories(category string) []string {
+	var tags []string
+	for _, part := range strings.Split(category, ",") {
+		if tag := strings.Trim(strings.TrimSpace(part), "/"); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,225 @@
+package beam
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Theme sets the look of the HTML pages
+type Theme struct {
+	CSS           template.CSS // stylesheet included in every page
+	StylesheetURL string       // stylesheet linked from every page, after CSS
+	DateFormat    string       // layout of dates, as for time.Format
+}
+
+// DefaultTheme is the theme of the default pages and a starting point for
+// custom themes
+var DefaultTheme = Theme{
+	CSS: `body { font-family: Arial, sans-serif; margin: 40px; background: #f9f9f9; }
+.feed-info { margin: 20px 0; }
+.entry { border: 1px solid #ddd; margin: 10px 0; padding: 15px; border-radius: 5px; background: #fff; overflow: hidden; }
+.thumbnail { float: right; width: 160px; height: 120px; margin: 0 0 10px 15px; object-fit: cover; }
+.tags { color: #666; font-size: 0.9em; }
+.source { font-size: 0.9em; color: #888; }`,
+	DateFormat: "2006-01-02 15:04",
+}
+
+// maxHomePageEntries is the number of entries listed on the aggregator page
+const maxHomePageEntries = 15
+
+// defaultTemplates defines the "feed", "entry" and "aggregator" pages
+const defaultTemplates = `
+{{define "head"}}<!DOCTYPE html>
+<html{{with .Feed.Language}} lang="{{.}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<title>{{with .Entry}}{{.Title}} - {{end}}{{.Feed.Title}}</title>
+{{.AlternateLinks}}{{with .Theme.CSS}}<style>{{.}}</style>
+{{end}}{{with .Theme.StylesheetURL}}<link rel="stylesheet" href="{{.}}">
+{{end}}</head>
+<body>
+{{end}}
+
+{{define "foot"}}</body>
+</html>
+{{end}}
+
+{{define "entries"}}{{range .Entries}}<div class="entry">
+<h4><a href="{{.URL}}">{{.Title}}</a></h4>
+{{with $.Thumbnail .}}<img class="thumbnail" src="{{.URL}}" alt="{{.Alt}}"{{with .Width}} width="{{.}}"{{end}}{{with .Height}} height="{{.}}"{{end}} loading="lazy">
+{{end}}{{with .Summary}}<p>{{.}}</p>{{end}}
+<div class="tags">
+{{with .Category}}<strong>Category:</strong> {{.}}<br>{{end}}
+{{with .Tags}}<strong>Tags:</strong> {{range $i, $tag := .}}{{if $i}}, {{end}}{{$tag}}{{end}}<br>{{end}}
+{{with .ReadingTime}}<strong>Reading time:</strong> {{.}} minutes<br>{{end}}
+<strong>Published:</strong> {{$.FormatDate .Published}} &middot; <a href="{{$.Permalink .}}">Permalink</a>
+</div>
+</div>
+{{else}}<p>No entries available.</p>
+{{end}}{{end}}
+
+{{define "feed"}}{{template "head" .}}<div class="feed-info">
+<h1>{{.Feed.Title}}</h1>
+{{with .Feed.Description}}<p>{{.}}</p>{{end}}
+{{with .Feed.FeedURL}}<p><strong>Feed URL:</strong> <a href="{{.}}">{{.}}</a></p>{{end}}
+<p><strong>Entries:</strong> {{len .Feed.Items}}</p>
+</div>
+<h3>Recent Entries</h3>
+{{template "entries" .}}{{template "foot" .}}{{end}}
+
+{{define "entry"}}{{template "head" .}}{{with .Entry}}<div class="entry">
+<h1><a href="{{.URL}}">{{.Title}}</a></h1>
+<div class="source">
+{{with .Author}}{{.Name}} &middot; {{end}}Published: {{$.FormatDate .Published}}{{with .Updated}} &middot; Updated: {{$.FormatDate .}}{{end}}
+</div>
+{{with $.Content .}}<div class="content">{{.}}</div>{{else}}{{with .Summary}}<p>{{.}}</p>{{end}}{{end}}
+{{with .Attachments}}<ul class="attachments">
+{{range .}}<li><a href="{{.URL}}">{{or .Title .URL}}</a> <span class="source">({{.MIMEType}})</span></li>
+{{end}}</ul>
+{{end}}<div class="tags">
+{{with .Category}}<strong>Category:</strong> {{.}}<br>{{end}}
+{{with .Tags}}<strong>Tags:</strong> {{range $i, $tag := .}}{{if $i}}, {{end}}{{$tag}}{{end}}{{end}}
+</div>
+</div>{{end}}
+<p><a href="{{.PageURL}}">&larr; {{.Feed.Title}}</a></p>
+{{template "foot" .}}{{end}}
+
+{{define "aggregator"}}{{template "head" .}}<h1>{{.Feed.Title}}</h1>
+{{with .Feed.FeedURL}}<p><strong>Feed URL:</strong> <a href="{{.}}">{{.}}</a></p>{{end}}
+{{with .Feed.LastUpdated}}<p>Last Updated: <strong>{{$.FormatDate .}}</strong></p>{{end}}
+<h2>Sources</h2>
+<ul>
+{{range .Sources}}<li><strong>{{.Name}}</strong> - <a href="{{.URL}}">{{.URL}}</a>{{with .Description}} <span class="source">({{.}})</span>{{end}}</li>
+{{end}}</ul>
+<hr>
+<h3>Recent Entries</h3>
+{{template "entries" .}}{{template "foot" .}}{{end}}
+`
+
+// Pages renders the HTML pages of feeds and aggregators with html/template,
+// which escapes every value taken from a feed. Templates are executed with
+// a PageData.
+type Pages struct {
+	templates *template.Template
+	theme     Theme
+}
+
+// baseTemplates holds the parsed default templates. It is never executed,
+// as html/template cannot clone executed templates.
+var baseTemplates = template.Must(template.New("pages").Parse(defaultTemplates))
+
+// defaultPages renders pages from the default templates and theme
+var defaultPages = &Pages{templates: template.Must(baseTemplates.Clone()), theme: DefaultTheme}
+
+// NewPages creates pages with a theme. templates may redefine any of the
+// "feed", "entry" and "aggregator" templates, or the "head", "foot" and
+// "entries" templates they share; the default definitions are used for
+// the others. A zero theme's DateFormat defaults to DefaultTheme's.
+func NewPages(theme Theme, templates string) (*Pages, error) {
+	t, err := baseTemplates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if templates != "" {
+		if t, err = t.Parse(templates); err != nil {
+			return nil, fmt.Errorf("failed to parse templates: %w", err)
+		}
+	}
+	if theme.DateFormat == "" {
+		theme.DateFormat = DefaultTheme.DateFormat
+	}
+	return &Pages{templates: t, theme: theme}, nil
+}
+
+// PageData is the data the page templates are executed with
+type PageData struct {
+	Theme          Theme
+	Feed           *Feed
+	Entries        []Entry       // entries listed on the page
+	Entry          *Entry        // entry of a permalink page
+	Sources        []FeedSource  // sources of an aggregator page
+	AlternateLinks template.HTML // feed discovery links for the <head>
+	PageURL        string        // path of the page, which permalinks are relative to
+}
+
+// Permalink returns the URL of the permalink page of an entry
+func (d PageData) Permalink(entry Entry) string {
+	query := url.Values{"entry": {entry.ID}}
+	if source := entrySourceID(entry); source != "" {
+		query.Set("source", source)
+	}
+	return d.PageURL + "?" + query.Encode()
+}
+
+// FormatDate formats a date with the theme's date format
+func (d PageData) FormatDate(t time.Time) string {
+	return t.Local().Format(d.Theme.DateFormat)
+}
+
+// Content returns an entry's content as HTML, sanitized with
+// DefaultSanitizePolicy
+func (d PageData) Content(entry Entry) template.HTML {
+	return template.HTML(SanitizeHTML(entry.Content, entry.URL))
+}
+
+// Thumbnail returns an entry's featured image, or nil if it has none
+func (d PageData) Thumbnail(entry Entry) *ImageInfo {
+	info, ok := entry.FeaturedImage()
+	if !ok {
+		return nil
+	}
+	return &info
+}
+
+// render executes the named page template with data
+func (p *Pages) render(w io.Writer, name string, data PageData) error {
+	data.Theme = p.theme
+	return p.templates.ExecuteTemplate(w, name, data)
+}
+
+// serve renders a page as the response to a request. The permalink page
+// of the entry named by the entry and source query parameters is served
+// instead when they are set.
+func (p *Pages) serve(w http.ResponseWriter, r *http.Request, name string, data PageData) {
+	data.PageURL = r.URL.Path
+	if id := r.URL.Query().Get("entry"); id != "" {
+		entry, ok := findEntry(data.Feed.Items, id, r.URL.Query().Get("source"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		name, data.Entry, data.Entries = "entry", &entry, nil
+	}
+
+	var b strings.Builder
+	if err := p.render(&b, name, data); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeHTML)
+	io.WriteString(w, b.String())
+}
+
+// findEntry returns the entry with the given ID, from the given source
+// if source is set
+func findEntry(entries []Entry, id, source string) (Entry, bool) {
+	for _, entry := range entries {
+		if entry.ID == id && (source == "" || entrySourceID(entry) == source) {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// pagesOrDefault returns p, or the default pages if p is nil
+func pagesOrDefault(p *Pages) *Pages {
+	if p != nil {
+		return p
+	}
+	return defaultPages
+}
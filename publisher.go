@@ -0,0 +1,131 @@
+package beam
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Publisher serves a feed that changes while it is being served.
+//
+// A Feed must not be modified while ServeHTTP runs, as it reads the feed
+// without locking. A Publisher instead holds an immutable version of the
+// feed: every change is applied to a copy that then replaces the current
+// version atomically, so requests always see a complete version and never
+// wait for writers. The encoded documents of each version are cached.
+type Publisher struct {
+	mu      sync.Mutex // serializes updates
+	current atomic.Pointer[Feed]
+}
+
+// NewPublisher creates a publisher of a copy of feed. The feed passed in
+// is not used afterwards.
+func NewPublisher(feed *Feed) *Publisher {
+	p := &Publisher{}
+	p.current.Store(feed.clone())
+	return p
+}
+
+// Feed returns the current version of the feed. It must not be modified;
+// use Update to change the feed.
+func (p *Publisher) Feed() *Feed {
+	return p.current.Load()
+}
+
+// Update applies fn to a copy of the current feed and publishes the copy.
+// Updates are serialized; requests served meanwhile see the previous
+// version. The feed's WebSub hub is pinged once the copy is published, so
+// the hub fetches the new version.
+func (p *Publisher) Update(fn func(f *Feed)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	next := p.current.Load().clone()
+	next.holdPing = true
+	fn(next)
+	ping := next.pingHeld
+	next.holdPing, next.pingHeld = false, false
+	p.current.Store(next)
+
+	if ping {
+		next.notifyHub()
+	}
+}
+
+// AddEntry adds an entry to the feed, see Feed.AddEntry
+func (p *Publisher) AddEntry(entry Entry) {
+	p.Update(func(f *Feed) { f.AddEntry(entry) })
+}
+
+// UpsertEntry adds or replaces an entry of the feed, see Feed.UpsertEntry
+func (p *Publisher) UpsertEntry(entry Entry) {
+	p.Update(func(f *Feed) { f.UpsertEntry(entry) })
+}
+
+// RemoveEntry removes an entry of the feed, see Feed.RemoveEntry
+func (p *Publisher) RemoveEntry(id string) bool {
+	removed := false
+	p.Update(func(f *Feed) { removed = f.RemoveEntry(id) })
+	return removed
+}
+
+// ServeHTTP serves the current version of the feed, see Feed.ServeHTTP
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.current.Load().ServeHTTP(w, r)
+}
+
+// HomePage serves the HTML page of the current version of the feed
+func (p *Publisher) HomePage(w http.ResponseWriter, r *http.Request) {
+	p.current.Load().HomePage(w, r)
+}
+
+// clone returns a copy of the feed that shares no mutable state with it,
+// with a document cache of its own
+func (f *Feed) clone() *Feed {
+	c := *f
+	if f.LastUpdated != nil {
+		updated := *f.LastUpdated
+		c.LastUpdated = &updated
+	}
+	if f.Author != nil {
+		author := *f.Author
+		c.Author = &author
+	}
+	c.Items = make([]Entry, len(f.Items))
+	for i, entry := range f.Items {
+		c.Items[i] = entry.clone()
+	}
+	c.Tombstones = append([]Tombstone(nil), f.Tombstones...)
+	c.encoded = &encodedCache{}
+	return &c
+}
+
+// clone returns a copy of the entry that shares no mutable state with it
+func (e Entry) clone() Entry {
+	if e.Updated != nil {
+		updated := *e.Updated
+		e.Updated = &updated
+	}
+	if e.Author != nil {
+		author := *e.Author
+		e.Author = &author
+	}
+	if e.ImageInfo != nil {
+		info := *e.ImageInfo
+		e.ImageInfo = &info
+	}
+	if e.Attachments != nil {
+		e.Attachments = append([]Attachment{}, e.Attachments...)
+	}
+	if e.Tags != nil {
+		e.Tags = append([]string{}, e.Tags...)
+	}
+	if e.Extensions != nil {
+		extensions := make(ExtensionFields, len(e.Extensions))
+		for key, value := range e.Extensions {
+			extensions[key] = value
+		}
+		e.Extensions = extensions
+	}
+	return e
+}
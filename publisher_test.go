@@ -0,0 +1,41 @@
+package beam
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPublisherPingsHubAfterPublishing(t *testing.T) {
+	var p *Publisher
+	seen := make(chan int, 1)
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The hub fetches the feed as soon as it is pinged
+		seen <- len(p.Feed().Items)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer hub.Close()
+
+	feed := NewFeed("Test", "https://example.com/feed")
+	feed.Hub = hub.URL
+	p = NewPublisher(feed)
+	p.Update(func(f *Feed) {
+		f.AddEntry(NewEntry("a", "A", "https://example.com/a", time.Now()))
+		f.AddEntry(NewEntry("b", "B", "https://example.com/b", time.Now()))
+	})
+
+	select {
+	case n := <-seen:
+		if n != 2 {
+			t.Fatalf("hub saw %d entries, want 2", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hub was not pinged")
+	}
+	select {
+	case <-seen:
+		t.Fatal("hub pinged more than once for one update")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,225 @@
+package beam
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeedQuery narrows a feed to the entries an HTTP client asked for.
+// Filter selects by tag, category and source; From and To bound the
+// publication date, inclusively; Author matches the entry author's name
+// or email. Since selects the entries published or updated after it and
+// the tombstones of entries deleted after it. Limit and Cursor page
+// through the matching entries, newest first.
+type FeedQuery struct {
+	Filter EntryFilter
+	From   time.Time
+	To     time.Time
+	Author string
+	Since  time.Time
+	Limit  int
+	Cursor string
+}
+
+// queryParams are the query parameters that select a view of a feed
+var queryParams = []string{"tag", "category", "source", "from", "to", "author", "since", "limit", "cursor", "page"}
+
+// ParseFeedQuery reads a FeedQuery from URL query parameters: tag,
+// category and source (each repeatable), from and to (RFC 3339 or
+// YYYY-MM-DD), author, since (RFC 3339 or a sync cursor), limit and
+// cursor. Other parameters are ignored.
+func ParseFeedQuery(values url.Values) (FeedQuery, error) {
+	q := FeedQuery{
+		Filter: EntryFilter{
+			Tags:       values["tag"],
+			Categories: values["category"],
+			Sources:    values["source"],
+		},
+		Author: strings.TrimSpace(values.Get("author")),
+		Cursor: values.Get("cursor"),
+	}
+
+	var err error
+	if q.From, err = parseQueryTime(values.Get("from"), false); err != nil {
+		return FeedQuery{}, NewError("from", err.Error())
+	}
+	if q.To, err = parseQueryTime(values.Get("to"), true); err != nil {
+		return FeedQuery{}, NewError("to", err.Error())
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return FeedQuery{}, NewError("to", "to must not be before from")
+	}
+	if since := values.Get("since"); since != "" {
+		if q.Since, err = parseSince(since); err != nil {
+			return FeedQuery{}, NewError("since", err.Error())
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit <= 0 {
+			return FeedQuery{}, NewError("limit", "limit must be a positive integer")
+		}
+	}
+	if q.Cursor != "" {
+		if _, _, err := decodeCursor(q.Cursor); err != nil {
+			return FeedQuery{}, NewError("cursor", "invalid cursor")
+		}
+	}
+	return q, nil
+}
+
+// parseQueryTime parses a date or timestamp parameter. A bare date used
+// as an upper bound covers the whole day.
+func parseQueryTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %s", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// IsZero reports whether the query selects the whole feed
+func (q FeedQuery) IsZero() bool {
+	return q.Filter.IsZero() && q.From.IsZero() && q.To.IsZero() &&
+		q.Author == "" && q.Since.IsZero() && q.Limit == 0 && q.Cursor == ""
+}
+
+// Match reports whether an entry of feed f satisfies the query's filters
+func (q FeedQuery) Match(f *Feed, entry Entry) bool {
+	if !q.Filter.Match(entry) {
+		return false
+	}
+	if !q.From.IsZero() && entry.Published.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && entry.Published.After(q.To) {
+		return false
+	}
+	if !q.Since.IsZero() && !changedSince(entry, q.Since) {
+		return false
+	}
+	if q.Author != "" {
+		// Entries without an author are written by the feed author
+		author := entry.Author
+		if author == nil {
+			author = f.Author
+		}
+		if author == nil || (!strings.EqualFold(author.Name, q.Author) && !strings.EqualFold(author.Email, q.Author)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns a copy of the feed holding the entries that match q.
+// When q pages (Limit or Cursor set), entries are ordered newest first and
+// nextCursor is set if more entries follow the returned page. With Since
+// set, the copy is a delta that also holds the tombstones of entries
+// deleted after it.
+func (f *Feed) Query(q FeedQuery) (page *Feed, nextCursor string, err error) {
+	var items []Entry
+	for _, entry := range f.Items {
+		if q.Match(f, entry) {
+			items = append(items, entry)
+		}
+	}
+
+	if q.Limit > 0 || q.Cursor != "" {
+		sort.SliceStable(items, func(i, j int) bool {
+			return entryBefore(items[i], items[j])
+		})
+
+		if q.Cursor != "" {
+			published, id, err := decodeCursor(q.Cursor)
+			if err != nil {
+				return nil, "", NewError("cursor", "invalid cursor")
+			}
+			cursor := Entry{ID: id, Published: published}
+			start := sort.Search(len(items), func(i int) bool {
+				return entryBefore(cursor, items[i])
+			})
+			items = items[start:]
+		}
+
+		if q.Limit > 0 && len(items) > q.Limit {
+			items = items[:q.Limit]
+			nextCursor = encodeCursor(items[len(items)-1])
+		}
+	}
+
+	view := *f
+	view.Items = items
+	if view.Items == nil {
+		view.Items = make([]Entry, 0)
+	}
+	view.NextURL = ""
+	view.encoded = nil
+	if !q.Since.IsZero() {
+		view.Delta = true
+		view.Tombstones = tombstonesSince(f.Tombstones, q.Since)
+	}
+	return &view, nextCursor, nil
+}
+
+// entryBefore orders entries newest first, by ID among equal dates
+func entryBefore(a, b Entry) bool {
+	if !a.Published.Equal(b.Published) {
+		return a.Published.After(b.Published)
+	}
+	return a.ID < b.ID
+}
+
+// encodeCursor returns the cursor of the page following entry
+func encodeCursor(entry Entry) string {
+	raw := strconv.FormatInt(entry.Published.UnixNano(), 10) + ":" + entry.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor returns the date and ID of the entry a cursor points after
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return time.Unix(0, n), id, nil
+}
+
+// queryVariant returns a short digest of the query parameters of a
+// request, distinguishing the entity tags of different queries
+func queryVariant(values url.Values) string {
+	selected := make(url.Values)
+	for _, key := range queryParams {
+		if list, ok := values[key]; ok {
+			selected[key] = list
+		}
+	}
+	if len(selected) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(selected.Encode()))
+	return hex.EncodeToString(sum[:6])
+}
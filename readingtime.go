@@ -0,0 +1,143 @@
+package beam
+
+import (
+	"html"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ReadingTimeEstimator estimates how long HTML content takes to read.
+// Text is counted in words separated by spaces, except that Chinese and
+// Japanese characters, which are written without spaces, are counted one
+// by one when CharactersPerMinute is set.
+type ReadingTimeEstimator struct {
+	WordsPerMinute      int           // reading speed in words; 200 if 0
+	CharactersPerMinute int           // reading speed in CJK characters; 0 counts them as words
+	ImageTime           time.Duration // extra time per image
+	CodeBlockTime       time.Duration // time per code block, whose text is then not counted
+	DecodeEntities      bool          // decode HTML entities such as &nbsp; before counting
+}
+
+// DefaultReadingTimeEstimator is used by CalculateReadingTime: 200 words
+// per minute, with no extra time for images or code
+var DefaultReadingTimeEstimator = ReadingTimeEstimator{WordsPerMinute: 200}
+
+// CJKReadingTimeEstimator suits content that mixes CJK and other text,
+// counting CJK characters at 500 per minute, with time for images and code
+var CJKReadingTimeEstimator = ReadingTimeEstimator{
+	WordsPerMinute:      200,
+	CharactersPerMinute: 500,
+	ImageTime:           12 * time.Second,
+	CodeBlockTime:       30 * time.Second,
+	DecodeEntities:      true,
+}
+
+// Estimate returns the time it takes to read content
+func (e ReadingTimeEstimator) Estimate(content string) time.Duration {
+	stats := e.count(content)
+
+	wpm := e.WordsPerMinute
+	if wpm <= 0 {
+		wpm = DefaultReadingTimeEstimator.WordsPerMinute
+	}
+	total := time.Duration(stats.words) * time.Minute / time.Duration(wpm)
+	if e.CharactersPerMinute > 0 {
+		total += time.Duration(stats.characters) * time.Minute / time.Duration(e.CharactersPerMinute)
+	}
+	total += time.Duration(stats.images) * e.ImageTime
+	total += time.Duration(stats.codeBlocks) * e.CodeBlockTime
+	return total
+}
+
+// Minutes returns the reading time of content in whole minutes, rounded
+// down, and at least 1 for any non-empty content
+func (e ReadingTimeEstimator) Minutes(content string) int {
+	if content == "" {
+		return 0
+	}
+	return max(int(e.Estimate(content)/time.Minute), 1)
+}
+
+// textStats counts what content holds
+type textStats struct {
+	words, characters, images, codeBlocks int
+}
+
+// count counts the words, CJK characters, images and code blocks of content
+func (e ReadingTimeEstimator) count(content string) textStats {
+	var stats textStats
+	var text strings.Builder
+
+	// Tags separate words, as do the boundaries of skipped code blocks
+	s := sanitizer{content: content}
+	for s.pos < len(s.content) {
+		lt := strings.IndexByte(s.content[s.pos:], '<')
+		if lt < 0 {
+			text.WriteString(s.content[s.pos:])
+			break
+		}
+		text.WriteString(s.content[s.pos : s.pos+lt])
+		s.pos += lt
+
+		rest := s.content[s.pos:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			s.skipPast("-->")
+		case len(rest) > 1 && (isASCIILetter(rest[1]) || rest[1] == '/' || rest[1] == '!' || rest[1] == '?'):
+			if rest[1] == '!' || rest[1] == '?' {
+				s.skipPast(">")
+				break
+			}
+			tag := s.readTag()
+			switch {
+			case tag.end:
+			case tag.name == "img":
+				stats.images++
+			case tag.name == "pre":
+				stats.codeBlocks++
+				if e.CodeBlockTime > 0 {
+					s.skipElement(tag.name)
+				}
+			}
+		default:
+			text.WriteByte('<')
+			s.pos++
+			continue
+		}
+		text.WriteByte(' ')
+	}
+
+	plain := text.String()
+	if e.DecodeEntities {
+		plain = html.UnescapeString(plain)
+	}
+	for _, field := range strings.Fields(plain) {
+		if e.CharactersPerMinute <= 0 {
+			stats.words++
+			continue
+		}
+		// Count the CJK characters of a field one by one, and each run
+		// of other characters as a word
+		inWord := false
+		for _, r := range field {
+			if unicode.IsPunct(r) {
+				continue
+			}
+			if isCJK(r) {
+				stats.characters++
+				inWord = false
+			} else if !inWord {
+				stats.words++
+				inWord = true
+			}
+		}
+	}
+	return stats
+}
+
+// isCJK reports whether r belongs to a script written without spaces
+// between words
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
@@ -0,0 +1,195 @@
+package beam
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// rssDocument is the RSS 2.0 document structure
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel is the RSS 2.0 channel element.
+// AtomLinks precedes Link because encoding/xml hands an element to the
+// first field whose name matches, and Link would accept atom:link too.
+type rssChannel struct {
+	Title         string             `xml:"title"`
+	AtomLinks     []atomLink         `xml:"http://www.w3.org/2005/Atom link"`
+	Link          string             `xml:"link"`
+	Description   string             `xml:"description"`
+	Language      string             `xml:"language,omitempty"`
+	LastBuildDate string             `xml:"lastBuildDate,omitempty"`
+	Generator     string             `xml:"generator,omitempty"`
+	Archive       *struct{}          `xml:"http://purl.org/syndication/history/1.0 archive"`
+	Items         []rssItem          `xml:"item"`
+	Deleted       []atomDeletedEntry `xml:"http://purl.org/atompub/tombstones/1.0 deleted-entry"`
+}
+
+// rssItem is the RSS 2.0 item element
+type rssItem struct {
+	Title       string          `xml:"title"`
+	Link        string          `xml:"link,omitempty"`
+	GUID        rssGUID         `xml:"guid"`
+	PubDate     string          `xml:"pubDate,omitempty"`
+	Description string          `xml:"description,omitempty"`
+	Content     string          `xml:"http://purl.org/rss/1.0/modules/content/ encoded,omitempty"`
+	Author      string          `xml:"author,omitempty"`
+	Categories  []rssCategory   `xml:"category"`
+	Enclosures  []rssEnclosure  `xml:"enclosure"`
+	Duration    string          `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration,omitempty"`
+	Media       []mediaContent  `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnail   *mediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+// rssGUID is the RSS 2.0 guid element
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// rssCategory is the RSS 2.0 category element
+type rssCategory struct {
+	Value string `xml:",chardata"`
+}
+
+// ToRSS serializes the feed as an RSS 2.0 document
+func (f *Feed) ToRSS() ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.Title,
+		Link:        f.HomePageURL,
+		Description: f.Description,
+		Language:    f.Language,
+		Generator:   "beam-go",
+		AtomLinks:   []atomLink{{Href: f.FeedURL, Rel: "self", Type: "application/rss+xml"}},
+		Items:       make([]rssItem, 0, len(f.Items)),
+	}
+	if f.Hub != "" {
+		channel.AtomLinks = append(channel.AtomLinks, atomLink{Href: f.Hub, Rel: "hub"})
+	}
+	channel.AtomLinks = append(channel.AtomLinks, f.pagingLinks("application/rss+xml")...)
+	if f.Archive {
+		channel.Archive = &struct{}{}
+	}
+	if channel.Link == "" {
+		channel.Link = f.FeedURL
+	}
+	if channel.Description == "" {
+		channel.Description = f.Title
+	}
+	if f.LastUpdated != nil {
+		channel.LastBuildDate = f.LastUpdated.Format(time.RFC1123Z)
+	}
+
+	for _, entry := range f.Items {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.URL,
+			GUID:        rssGUID{Value: entry.ID},
+			PubDate:     entry.Published.Format(time.RFC1123Z),
+			Description: entry.Summary,
+			Content:     entry.Content,
+		}
+		if entry.Author != nil && entry.Author.Email != "" {
+			item.Author = entry.Author.Email
+			if entry.Author.Name != "" {
+				item.Author = fmt.Sprintf("%s (%s)", entry.Author.Email, entry.Author.Name)
+			}
+		}
+		for _, term := range entryTerms(entry) {
+			item.Categories = append(item.Categories, rssCategory{Value: term})
+		}
+		item.Enclosures = rssEnclosures(entry.Attachments)
+		if len(entry.Attachments) > 0 {
+			item.Duration = formatITunesDuration(entry.Attachments[0].Duration)
+		}
+		if media, thumbnail := mediaElements(entry); media != nil {
+			item.Media, item.Thumbnail = []mediaContent{*media}, thumbnail
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	channel.Deleted = atomDeletedEntries(f.Tombstones)
+
+	data, err := xml.MarshalIndent(rssDocument{Version: "2.0", Channel: channel}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// rssTimeLayouts lists the date formats seen in RSS feeds in the wild
+var rssTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+}
+
+// parseRSSTime parses an RSS date, returning the zero time if it is not recognized
+func parseRSSTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range rssTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// fromRSS converts an RSS 2.0 document into a BEAM feed.
+// Items without a usable ID, URL or date are skipped.
+func fromRSS(data []byte) (*Feed, error) {
+	var doc rssDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse RSS: %w", err)
+	}
+
+	channel := doc.Channel
+	feedURL := ""
+	for _, link := range channel.AtomLinks {
+		if link.Rel == "self" {
+			feedURL = link.Href
+		}
+	}
+
+	feed := NewFeed(channel.Title, feedURL)
+	feed.Description = channel.Description
+	feed.HomePageURL = channel.Link
+	feed.Language = channel.Language
+	feed.Hub = atomLinkHref(channel.AtomLinks, "hub")
+	feed.setPagingLinks(channel.AtomLinks)
+	feed.Archive = channel.Archive != nil
+
+	for _, item := range channel.Items {
+		id := item.GUID.Value
+		if id == "" {
+			id = item.Link
+		}
+
+		entry := NewEntry(id, item.Title, item.Link, parseRSSTime(item.PubDate))
+		entry.Summary = item.Description
+		if item.Content != "" {
+			entry.SetContent(item.Content)
+		}
+		for _, category := range item.Categories {
+			entry.Tags = append(entry.Tags, category.Value)
+		}
+		fromMediaElements(&entry, item.Media, item.Thumbnail)
+		entry.Attachments = fromRSSEnclosures(item.Enclosures, item.Duration)
+		if entry.Validate() != nil {
+			continue
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+	feed.Tombstones = fromAtomDeletedEntries(channel.Deleted)
+
+	return feed, nil
+}
@@ -0,0 +1,421 @@
+package beam
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+// SanitizePolicy is an allowlist of the HTML that sanitized content keeps.
+// Elements that are not allowed are removed but their text is kept;
+// attributes that are not allowed are removed. Scripts, styles, frames
+// and embedded objects are always removed with their content, and event
+// handler attributes are never kept.
+type SanitizePolicy struct {
+	// Elements lists the allowed elements
+	Elements []string
+	// Attributes lists the allowed attributes per element; the attributes
+	// listed for "*" are allowed on every allowed element
+	Attributes map[string][]string
+	// URLSchemes lists the schemes allowed in URL attributes such as href
+	// and src. Relative URLs are always allowed.
+	URLSchemes []string
+}
+
+// DefaultSanitizePolicy allows common text formatting, links, images,
+// lists and tables, with http, https and mailto URLs
+var DefaultSanitizePolicy = SanitizePolicy{
+	Elements: []string{
+		"a", "abbr", "b", "blockquote", "br", "caption", "cite", "code",
+		"dd", "del", "details", "div", "dl", "dt", "em", "figcaption",
+		"figure", "h1", "h2", "h3", "h4", "h5", "h6", "hr", "i", "img",
+		"ins", "kbd", "li", "mark", "ol", "p", "pre", "q", "s", "small",
+		"span", "strong", "sub", "summary", "sup", "table", "tbody", "td",
+		"tfoot", "th", "thead", "time", "tr", "u", "ul",
+	},
+	Attributes: map[string][]string{
+		"*":          {"title", "lang", "dir"},
+		"a":          {"href"},
+		"img":        {"src", "alt", "width", "height"},
+		"blockquote": {"cite"},
+		"q":          {"cite"},
+		"del":        {"cite", "datetime"},
+		"ins":        {"cite", "datetime"},
+		"time":       {"datetime"},
+		"ol":         {"start", "reversed"},
+		"td":         {"colspan", "rowspan"},
+		"th":         {"colspan", "rowspan", "scope"},
+	},
+	URLSchemes: []string{"http", "https", "mailto"},
+}
+
+// droppedElements are removed together with their content under any policy
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true,
+	"frameset": true, "object": true, "embed": true, "applet": true,
+	"noscript": true, "noembed": true, "noframes": true, "template": true,
+	"svg": true, "math": true, "textarea": true, "title": true, "xmp": true,
+	"plaintext": true, "head": true,
+}
+
+// rawTextElements hold text that is not parsed as markup
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "noembed": true,
+	"noframes": true, "noscript": true, "textarea": true, "title": true,
+	"xmp": true, "plaintext": true,
+}
+
+// voidElements have no end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// urlAttributes hold URLs, which are checked against the allowed schemes
+// and resolved against the base URL
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "cite": true, "poster": true, "action": true,
+	"background": true, "longdesc": true,
+}
+
+// SanitizeHTML sanitizes content with DefaultSanitizePolicy, resolving
+// relative links against baseURL
+func SanitizeHTML(content, baseURL string) string {
+	return DefaultSanitizePolicy.Sanitize(content, baseURL)
+}
+
+// Sanitize returns content holding only the markup the policy allows.
+// Relative URLs are resolved against baseURL, if it is set, so the content
+// still works when republished elsewhere. The result is well-formed: text
+// is escaped and every element kept is closed.
+func (p SanitizePolicy) Sanitize(content, baseURL string) string {
+	s := sanitizer{
+		policy:  p,
+		content: content,
+		allowed: make(map[string]bool, len(p.Elements)),
+		schemes: make(map[string]bool, len(p.URLSchemes)),
+	}
+	for _, element := range p.Elements {
+		s.allowed[strings.ToLower(element)] = true
+	}
+	for _, scheme := range p.URLSchemes {
+		s.schemes[strings.ToLower(scheme)] = true
+	}
+	s.base = parseBaseURL(baseURL)
+	return s.run()
+}
+
+// parseBaseURL parses the URL relative URLs are resolved against, returning
+// nil if it is not an absolute URL
+func parseBaseURL(baseURL string) *url.URL {
+	if baseURL == "" {
+		return nil
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil || !base.IsAbs() {
+		return nil
+	}
+	return base
+}
+
+// htmlTag is a start or end tag read by the sanitizer
+type htmlTag struct {
+	name  string
+	end   bool
+	attrs [][2]string
+}
+
+// sanitizer holds the state of one Sanitize call
+type sanitizer struct {
+	policy  SanitizePolicy
+	content string
+	pos     int
+	allowed map[string]bool
+	schemes map[string]bool
+	base    *url.URL
+	open    []string // allowed elements that were written and not yet closed
+	out     strings.Builder
+}
+
+// run tokenizes the content and writes what the policy allows
+func (s *sanitizer) run() string {
+	for s.pos < len(s.content) {
+		lt := strings.IndexByte(s.content[s.pos:], '<')
+		if lt < 0 {
+			s.writeText(s.content[s.pos:])
+			break
+		}
+		s.writeText(s.content[s.pos : s.pos+lt])
+		s.pos += lt
+
+		rest := s.content[s.pos:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			s.skipPast("-->")
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			s.skipPast(">")
+		case len(rest) > 1 && (isASCIILetter(rest[1]) || (rest[1] == '/' && len(rest) > 2 && isASCIILetter(rest[2]))):
+			s.handleTag(s.readTag())
+		default:
+			// A lone "<" is text
+			s.out.WriteString("&lt;")
+			s.pos++
+		}
+	}
+
+	for i := len(s.open) - 1; i >= 0; i-- {
+		s.out.WriteString("</" + s.open[i] + ">")
+	}
+	return s.out.String()
+}
+
+// handleTag writes an allowed tag, or skips a dropped element
+func (s *sanitizer) handleTag(tag htmlTag) {
+	if droppedElements[tag.name] {
+		if !tag.end && !voidElements[tag.name] {
+			s.skipElement(tag.name)
+		}
+		return
+	}
+	if !s.allowed[tag.name] {
+		return
+	}
+
+	if tag.end {
+		for i := len(s.open) - 1; i >= 0; i-- {
+			if s.open[i] != tag.name {
+				continue
+			}
+			// Close the elements left open inside this one
+			for j := len(s.open) - 1; j >= i; j-- {
+				s.out.WriteString("</" + s.open[j] + ">")
+			}
+			s.open = s.open[:i]
+			break
+		}
+		return
+	}
+
+	s.out.WriteString("<" + tag.name)
+	for _, attr := range tag.attrs {
+		name, value := attr[0], attr[1]
+		if !s.allowedAttribute(tag.name, name) {
+			continue
+		}
+		if urlAttributes[name] {
+			var ok bool
+			if value, ok = s.sanitizeURL(value); !ok {
+				continue
+			}
+		}
+		s.out.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+	}
+	s.out.WriteString(">")
+	if !voidElements[tag.name] {
+		s.open = append(s.open, tag.name)
+	}
+}
+
+// allowedAttribute reports whether the policy allows an attribute on an element
+func (s *sanitizer) allowedAttribute(element, name string) bool {
+	if strings.HasPrefix(name, "on") {
+		return false
+	}
+	return s.listed(element, name)
+}
+
+// listed reports whether an attribute is listed for the element or for all elements
+func (s *sanitizer) listed(element, name string) bool {
+	for _, key := range []string{element, "*"} {
+		for _, attr := range s.policy.Attributes[key] {
+			if strings.EqualFold(attr, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sanitizeURL checks a URL attribute against the allowed schemes and
+// resolves it against the base URL
+func (s *sanitizer) sanitizeURL(value string) (string, bool) {
+	// Browsers ignore surrounding spaces and control characters inside
+	// URLs, as in "java\tscript:"
+	cleaned := strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+	u, err := url.Parse(cleaned)
+	if err != nil {
+		return "", false
+	}
+	if u.Scheme != "" {
+		return u.String(), s.schemes[strings.ToLower(u.Scheme)]
+	}
+	if s.base != nil {
+		u = s.base.ResolveReference(u)
+	}
+	return u.String(), true
+}
+
+// writeText writes text, escaped
+func (s *sanitizer) writeText(text string) {
+	s.out.WriteString(html.EscapeString(html.UnescapeString(text)))
+}
+
+// skipPast moves past the next occurrence of marker, or to the end
+func (s *sanitizer) skipPast(marker string) {
+	if i := strings.Index(s.content[s.pos:], marker); i >= 0 {
+		s.pos += i + len(marker)
+	} else {
+		s.pos = len(s.content)
+	}
+}
+
+// skipElement moves past the end tag of a dropped element, including
+// nested elements of the same name
+func (s *sanitizer) skipElement(name string) {
+	if rawTextElements[name] {
+		s.skipToEndTag(name)
+		return
+	}
+	for depth := 1; depth > 0 && s.pos < len(s.content); {
+		lt := strings.IndexByte(s.content[s.pos:], '<')
+		if lt < 0 {
+			s.pos = len(s.content)
+			return
+		}
+		s.pos += lt
+		rest := s.content[s.pos:]
+		if strings.HasPrefix(rest, "<!--") {
+			s.skipPast("-->")
+			continue
+		}
+		if len(rest) < 2 || !(isASCIILetter(rest[1]) || rest[1] == '/') {
+			s.pos++
+			continue
+		}
+		tag := s.readTag()
+		switch {
+		case tag.name != name:
+			if rawTextElements[tag.name] && !tag.end {
+				s.skipToEndTag(tag.name)
+			}
+		case tag.end:
+			depth--
+		default:
+			depth++
+		}
+	}
+}
+
+// skipToEndTag moves past the end tag of a raw text element
+func (s *sanitizer) skipToEndTag(name string) {
+	lower := strings.ToLower(s.content[s.pos:])
+	i := strings.Index(lower, "</"+name)
+	if i < 0 {
+		s.pos = len(s.content)
+		return
+	}
+	s.pos += i
+	s.skipPast(">")
+}
+
+// readTag reads the tag at the current position, which starts with "<"
+func (s *sanitizer) readTag() htmlTag {
+	var tag htmlTag
+	s.pos++ // "<"
+	if s.pos < len(s.content) && s.content[s.pos] == '/' {
+		tag.end = true
+		s.pos++
+	}
+	tag.name = strings.ToLower(s.readName())
+
+	for s.pos < len(s.content) {
+		s.skipSpace()
+		if s.pos >= len(s.content) {
+			break
+		}
+		switch c := s.content[s.pos]; {
+		case c == '>':
+			s.pos++
+			return tag
+		case c == '/':
+			s.pos++
+			continue
+		}
+
+		name := strings.ToLower(s.readName())
+		if name == "" {
+			// Not an attribute name; skip the character
+			s.pos++
+			continue
+		}
+		s.skipSpace()
+		value := ""
+		if s.pos < len(s.content) && s.content[s.pos] == '=' {
+			s.pos++
+			s.skipSpace()
+			value = html.UnescapeString(s.readValue())
+		}
+		tag.attrs = append(tag.attrs, [2]string{name, value})
+	}
+	return tag
+}
+
+// readName reads a tag or attribute name
+func (s *sanitizer) readName() string {
+	start := s.pos
+	for s.pos < len(s.content) {
+		c := s.content[s.pos]
+		if c == '>' || c == '/' || c == '=' || isHTMLSpace(c) || (c == '<' && s.pos > start) {
+			break
+		}
+		s.pos++
+	}
+	return s.content[start:s.pos]
+}
+
+// readValue reads a quoted or unquoted attribute value
+func (s *sanitizer) readValue() string {
+	if s.pos >= len(s.content) {
+		return ""
+	}
+	if quote := s.content[s.pos]; quote == '"' || quote == '\'' {
+		s.pos++
+		end := strings.IndexByte(s.content[s.pos:], quote)
+		if end < 0 {
+			value := s.content[s.pos:]
+			s.pos = len(s.content)
+			return value
+		}
+		value := s.content[s.pos : s.pos+end]
+		s.pos += end + 1
+		return value
+	}
+	start := s.pos
+	for s.pos < len(s.content) && !isHTMLSpace(s.content[s.pos]) && s.content[s.pos] != '>' {
+		s.pos++
+	}
+	return s.content[start:s.pos]
+}
+
+// skipSpace moves past whitespace
+func (s *sanitizer) skipSpace() {
+	for s.pos < len(s.content) && isHTMLSpace(s.content[s.pos]) {
+		s.pos++
+	}
+}
+
+// isHTMLSpace reports whether c is HTML whitespace
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// isASCIILetter reports whether c is an ASCII letter
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
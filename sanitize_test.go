@@ -0,0 +1,100 @@
+package beam
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	const base = "https://example.com/posts/1"
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// Dropped elements go with their content
+		{"script", `<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+		{"uppercase script", `a<SCRIPT type="text/javascript">alert(1)</SCRIPT >b`, `ab`},
+		{"unterminated script", `a<script>alert(1)`, `a`},
+		{"markup in script", `<script>document.write("</p><p>")</script>ok`, `ok`},
+		{"style", `<style>p { color: red }</style><p>x</p>`, `<p>x</p>`},
+		{"iframe", `<iframe src="https://evil.example/"><p>fallback</p></iframe>after`, `after`},
+		{"nested object", `<object><object></object>inner</object>after`, `after`},
+		{"script in svg", `<svg><script>alert(1)</script><text>t</text></svg>after`, `after`},
+		{"split script tag", `<scr<script>ipt>alert(1)</script>`, `ipt&gt;alert(1)`},
+
+		// Disallowed elements keep their text
+		{"unknown element", `<custom-tag>text</custom-tag>`, `text`},
+		{"form", `<form action="/x"><p>in</p></form>`, `<p>in</p>`},
+
+		// Attributes
+		{"event handler", `<p onclick="alert(1)" title="t">x</p>`, `<p title="t">x</p>`},
+		{"unquoted event handler", `<img src=x.png onerror=alert(1)>`, `<img src="https://example.com/posts/x.png">`},
+		{"style attribute", `<p style="background:url(javascript:alert(1))">x</p>`, `<p>x</p>`},
+		{"unlisted attribute", `<div class="c" id="i">x</div>`, `<div>x</div>`},
+		{"quoted angle bracket", `<a title="a>b" href="/x">x</a>`, `<a title="a&gt;b" href="https://example.com/x">x</a>`},
+
+		// URL schemes
+		{"javascript URL", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"mixed case scheme", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a>x</a>`},
+		{"leading space", `<a href="  javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"tab in scheme", "<a href=\"java\tscript:alert(1)\">x</a>", `<a>x</a>`},
+		{"newline in scheme", "<a href=\"java\nscript:alert(1)\">x</a>", `<a>x</a>`},
+		{"NUL in scheme", "<a href=\"java\x00script:alert(1)\">x</a>", `<a>x</a>`},
+		{"decimal entity", `<a href="&#106;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"padded entity without semicolon", `<a href="&#0000106avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"hex entity", `<a href="&#x6A;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"encoded tab", `<a href="jav&#x09;ascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"named colon entity", `<a href="javascript&colon;alert(1)">x</a>`, `<a>x</a>`},
+		{"data URL", `<img src="data:image/svg+xml;base64,PHN2Zz4=" alt="a">`, `<img alt="a">`},
+		{"data URL link", `<a href="data:text/html,<script>alert(1)</script>">x</a>`, `<a>x</a>`},
+		{"allowed schemes", `<a href="https://a.example/">a</a><a href="mailto:me@example.com">m</a>`,
+			`<a href="https://a.example/">a</a><a href="mailto:me@example.com">m</a>`},
+
+		// Relative URLs are resolved against the entry URL
+		{"root relative", `<a href="/about">x</a>`, `<a href="https://example.com/about">x</a>`},
+		{"path relative", `<img src="img/a.png">`, `<img src="https://example.com/posts/img/a.png">`},
+		{"protocol relative", `<a href="//cdn.example/x">x</a>`, `<a href="https://cdn.example/x">x</a>`},
+		{"fragment", `<a href="#note">x</a>`, `<a href="https://example.com/posts/1#note">x</a>`},
+		{"cite", `<blockquote cite="../src">q</blockquote>`, `<blockquote cite="https://example.com/src">q</blockquote>`},
+
+		// Unclosed and mismatched tags
+		{"unclosed", `<p><b>x`, `<p><b>x</b></p>`},
+		{"mismatched", `<b><i>x</b>y</i>`, `<b><i>x</i></b>y`},
+		{"stray end tag", `</p>stray</div>`, `stray`},
+		{"void element", `a<br>b<hr/>c`, `a<br>b<hr>c`},
+
+		// Comments and declarations
+		{"comment", `a<!-- <script>alert(1)</script> -->b`, `ab`},
+		{"unterminated comment", `a<!-- b`, `a`},
+		{"doctype", `<!DOCTYPE html>a`, `a`},
+		{"CDATA", `<![CDATA[x]]>a`, `a`},
+		{"processing instruction", `<?xml version="1.0"?>a`, `a`},
+
+		// Text
+		{"escaped text", `<p>"q" &amp; 'a' &lt;b&gt;</p>`, `<p>&#34;q&#34; &amp; &#39;a&#39; &lt;b&gt;</p>`},
+		{"lone angle bracket", `1 < 2`, `1 &lt; 2`},
+	}
+	for _, tt := range tests {
+		if got := SanitizeHTML(tt.in, base); got != tt.want {
+			t.Errorf("%s: SanitizeHTML(%q)\n got %q\nwant %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeWithoutBaseURL(t *testing.T) {
+	in := `<a href="/about">x</a><img src="a.png">`
+	if got := SanitizeHTML(in, ""); got != in {
+		t.Fatalf("SanitizeHTML without base URL = %q, want %q", got, in)
+	}
+}
+
+func TestSanitizePolicy(t *testing.T) {
+	policy := SanitizePolicy{
+		Elements:   []string{"A", "p"},
+		Attributes: map[string][]string{"a": {"href", "onclick"}},
+		URLSchemes: []string{"HTTPS"},
+	}
+	in := `<p><a href="http://example.com/" onclick="x">a</a><a href="https://example.com/">b</a><em>c</em></p>`
+	want := `<p><a>a</a><a href="https://example.com/">b</a>c</p>`
+	if got := policy.Sanitize(in, ""); got != want {
+		t.Fatalf("Sanitize = %q, want %q", got, want)
+	}
+}
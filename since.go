@@ -0,0 +1,80 @@
+package beam
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// SinceHeader asks a feed for the changes after a cursor or timestamp,
+	// like the since query parameter
+	SinceHeader = "X-Beam-Since"
+	// CursorHeader carries the cursor a client passes as since on its next
+	// request. Its presence advertises support for incremental fetches.
+	CursorHeader = "X-Beam-Cursor"
+)
+
+// Tombstone records that the entry with ID was deleted by its publisher
+type Tombstone struct {
+	ID      string    `json:"id"`
+	Deleted time.Time `json:"deleted"`
+
+	seq uint64 // archive page place of the deleted entry, see Feed.archiveSlots
+}
+
+// changedSince reports whether an entry was added to or replaced in its
+// feed after t. Entries that were not, such as those of a parsed feed, are
+// judged by their published and updated times.
+func changedSince(entry Entry, t time.Time) bool {
+	if !entry.changed.IsZero() {
+		return entry.changed.After(t)
+	}
+	return entry.Published.After(t) || (entry.Updated != nil && entry.Updated.After(t))
+}
+
+// markChanged bumps LastUpdated for a change to the feed and returns the
+// new value, which is always later than the previous one so a cursor taken
+// before the change never covers it
+func (f *Feed) markChanged() time.Time {
+	now := time.Now().UTC()
+	if f.LastUpdated != nil && !now.After(*f.LastUpdated) {
+		now = f.LastUpdated.Add(time.Nanosecond)
+	}
+	f.LastUpdated = &now
+	return now
+}
+
+// tombstonesSince returns the tombstones of entries deleted after t
+func tombstonesSince(tombstones []Tombstone, t time.Time) []Tombstone {
+	var recent []Tombstone
+	for _, tombstone := range tombstones {
+		if tombstone.Deleted.After(t) {
+			recent = append(recent, tombstone)
+		}
+	}
+	return recent
+}
+
+// encodeSyncCursor returns the cursor of a feed last updated at t
+func encodeSyncCursor(t time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixNano(), 10)))
+}
+
+// parseSince reads a since value, either an RFC 3339 timestamp or a cursor
+// from CursorHeader
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since: %s", value)
+	}
+	nanos, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since: %s", value)
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
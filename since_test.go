@@ -0,0 +1,63 @@
+package beam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fetchDelta requests the changes of a feed after cursor and returns the
+// IDs of the entries it sent, with the next cursor
+func fetchDelta(t *testing.T, h http.Handler, cursor string) ([]string, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	req.Header.Set("Accept", MediaTypeBEAM)
+	if cursor != "" {
+		req.Header.Set(SinceHeader, cursor)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	var feed Feed
+	if err := json.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(feed.Items))
+	for _, entry := range feed.Items {
+		ids = append(ids, entry.ID)
+	}
+	return ids, rec.Header().Get(CursorHeader)
+}
+
+func TestDeltaIncludesBackdatedAndReplacedEntries(t *testing.T) {
+	now := time.Now()
+	p := NewPublisher(NewFeed("Test", "https://example.com/feed"))
+	p.AddEntry(NewEntry("a", "A", "https://example.com/a", now.Add(-time.Hour)))
+
+	_, cursor := fetchDelta(t, p, "")
+	if cursor == "" {
+		t.Fatal("no cursor")
+	}
+
+	p.AddEntry(NewEntry("b", "B", "https://example.com/b", now.Add(-30*time.Minute)))
+	ids, cursor := fetchDelta(t, p, cursor)
+	if len(ids) != 1 || ids[0] != "b" {
+		t.Fatalf("delta after backdated add = %v, want [b]", ids)
+	}
+
+	edited := NewEntry("a", "A, edited", "https://example.com/a", now.Add(-time.Hour))
+	p.UpsertEntry(edited)
+	ids, cursor = fetchDelta(t, p, cursor)
+	if len(ids) != 1 || ids[0] != "a" {
+		t.Fatalf("delta after upsert = %v, want [a]", ids)
+	}
+
+	if ids, _ = fetchDelta(t, p, cursor); len(ids) != 0 {
+		t.Fatalf("delta without changes = %v, want none", ids)
+	}
+}
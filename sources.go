@@ -0,0 +1,243 @@
+package beam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// KindSourceExtension is the key used for storing the source ID on aggregated entries.
+const KindSourceExtension KindExtension = "_source"
+
+// SourceUpdate describes changes to a source's metadata.
+// Nil fields are left unchanged; a non-nil empty Tags slice clears the tags.
+type SourceUpdate struct {
+	Name        *string
+	Description *string
+	URL         *string
+	Group       *string
+	Tags        []string
+}
+
+// addSourceLocked assigns an ID to src and appends it to the sources.
+// The caller must hold a.mu for writing.
+func (a *Aggregator) addSourceLocked(src FeedSource) (string, error) {
+	if !isValidURL(src.URL) {
+		return "", NewError("url", "url must be a valid URL")
+	}
+	if existing := a.findSourceByURLLocked(src.URL); existing != nil {
+		return existing.ID, fmt.Errorf("%w: %s is already added as %s", ErrDuplicateSource, src.URL, existing.ID)
+	}
+
+	src.ID = a.newSourceIDLocked(src.URL)
+	if src.Status == "" {
+		src.Status = "new"
+	}
+	a.Sources = append(a.Sources, src)
+	return src.ID, nil
+}
+
+// newSourceIDLocked derives a stable ID for a source from its URL.
+// The ID is kept when the source is later re-pointed at another URL.
+func (a *Aggregator) newSourceIDLocked(sourceURL string) string {
+	seed := normalizeSourceURL(sourceURL)
+	for i := 0; ; i++ {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", seed, i)))
+		id := hex.EncodeToString(hash[:6])
+		if a.sourceIndexLocked(id) < 0 {
+			return id
+		}
+	}
+}
+
+// sourceIndexLocked returns the index of the source with the given ID, or -1
+func (a *Aggregator) sourceIndexLocked(id string) int {
+	for i := range a.Sources {
+		if a.Sources[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// findSourceByURLLocked returns the source whose feed or home page URL
+// matches sourceURL, or nil
+func (a *Aggregator) findSourceByURLLocked(sourceURL string) *FeedSource {
+	normalized := normalizeSourceURL(sourceURL)
+	for i := range a.Sources {
+		if normalizeSourceURL(a.Sources[i].URL) == normalized ||
+			(a.Sources[i].HomePageURL != "" && normalizeSourceURL(a.Sources[i].HomePageURL) == normalized) {
+			return &a.Sources[i]
+		}
+	}
+	return nil
+}
+
+// normalizeSourceURL canonicalizes a URL for duplicate detection
+func normalizeSourceURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return strings.TrimSpace(rawURL)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
+
+// GetSource returns the source with the given ID
+func (a *Aggregator) GetSource(id string) (FeedSource, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	i := a.sourceIndexLocked(id)
+	if i < 0 {
+		return FeedSource{}, false
+	}
+	return a.Sources[i], true
+}
+
+// RemoveSource removes a source and forgets its entry history. Its entries
+// are dropped from the aggregated feed, with tombstones, on the next
+// aggregation.
+func (a *Aggregator) RemoveSource(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.sourceIndexLocked(id)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrSourceNotFound, id)
+	}
+
+	removed := a.Sources[i]
+	fmt.Printf("Removed source: %s (%s)\n", removed.Name, removed.URL)
+	a.Sources = append(a.Sources[:i], a.Sources[i+1:]...)
+	a.history.removeSource(id)
+	a.unsubscribeLocked(id)
+	a.persistLocked()
+	a.publishSourceEvent(EventSourceRemoved, removed, nil)
+	return nil
+}
+
+// UpdateSource changes a source's metadata. Re-pointing a source at a new
+// URL resets its fetch status, and its entries are replaced by those of
+// the new URL on the next aggregation. Renaming a source relabels its
+// entries on the next aggregation.
+func (a *Aggregator) UpdateSource(id string, update SourceUpdate) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.sourceIndexLocked(id)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrSourceNotFound, id)
+	}
+	src := &a.Sources[i]
+
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return NewError("name", "name is required")
+	}
+	if update.URL != nil && normalizeSourceURL(*update.URL) != normalizeSourceURL(src.URL) {
+		if !isValidURL(*update.URL) {
+			return NewError("url", "url must be a valid URL")
+		}
+		if existing := a.findSourceByURLLocked(*update.URL); existing != nil && existing.ID != id {
+			return fmt.Errorf("%w: %s is already added as %s", ErrDuplicateSource, *update.URL, existing.ID)
+		}
+		src.URL = *update.URL
+		src.HomePageURL = ""
+		src.Status = "new"
+		src.ErrorMsg = ""
+		src.ETag, src.LastModified = "", ""
+		src.SinceCursor = ""
+		src.Hub = ""
+		src.Backfilled = false
+		a.history.removeSource(id)
+		a.unsubscribeLocked(id)
+	}
+	if update.Name != nil {
+		src.Name = *update.Name
+	}
+	if update.Description != nil {
+		src.Description = *update.Description
+	}
+	if update.Group != nil {
+		src.Group = strings.Trim(*update.Group, "/")
+	}
+	if update.Tags != nil {
+		src.Tags = append([]string(nil), update.Tags...)
+	}
+	a.persistLocked()
+	a.publishSourceEvent(EventSourceUpdated, *src, nil)
+	return nil
+}
+
+// EnableSource resumes fetching a disabled source
+func (a *Aggregator) EnableSource(id string) error {
+	return a.setSourceDisabled(id, false)
+}
+
+// DisableSource pauses a source. It is no longer fetched and its entries
+// are left out of the aggregated feed from the next aggregation on.
+func (a *Aggregator) DisableSource(id string) error {
+	return a.setSourceDisabled(id, true)
+}
+
+// setSourceDisabled toggles whether a source takes part in aggregation
+func (a *Aggregator) setSourceDisabled(id string, disabled bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.sourceIndexLocked(id)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrSourceNotFound, id)
+	}
+
+	a.Sources[i].Disabled = disabled
+	if disabled {
+		a.Sources[i].Status = "disabled"
+	} else {
+		a.Sources[i].Status = "new"
+	}
+	a.persistLocked()
+	a.publishSourceEvent(EventSourceUpdated, a.Sources[i], nil)
+	return nil
+}
+
+// SourcesInGroup returns the sources in the given group, including sources
+// in nested groups below it
+func (a *Aggregator) SourcesInGroup(group string) []FeedSource {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	group = strings.Trim(group, "/")
+	var sources []FeedSource
+	for _, src := range a.Sources {
+		if src.Group == group || strings.HasPrefix(src.Group, group+"/") {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+// SourcesWithTag returns the sources carrying the given tag
+func (a *Aggregator) SourcesWithTag(tag string) []FeedSource {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var sources []FeedSource
+	for _, src := range a.Sources {
+		for _, t := range src.Tags {
+			if strings.EqualFold(t, tag) {
+				sources = append(sources, src)
+				break
+			}
+		}
+	}
+	return sources
+}
@@ -0,0 +1,217 @@
+package beam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sseClientBuffer is the default number of events that may queue up for
+// one client before it is disconnected, see EventStream.SetClientBuffer
+const sseClientBuffer = 64
+
+// EventStream is an http.Handler streaming new and updated aggregated
+// entries as Server-Sent Events. Each event's ID is its aggregator event
+// sequence number, so a reconnecting client sending Last-Event-ID is
+// replayed what it missed, as far as the replay buffer reaches.
+//
+// Streams can be narrowed with the query parameters tag, category and
+// source, each repeatable, with the semantics of EntryFilter.
+type EventStream struct {
+	sub          *Subscription
+	heartbeat    time.Duration
+	clientBuffer int
+
+	mu      sync.Mutex
+	replay  []Event // oldest first
+	size    int
+	clients map[chan Event]struct{}
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewEventStream creates an SSE handler for the aggregator's entries,
+// keeping the last replaySize events for resumption. Call Close to end
+// all streams.
+func NewEventStream(a *Aggregator, replaySize int) *EventStream {
+	s := &EventStream{
+		sub:          a.Subscribe(1024, EventEntryNew, EventEntryUpdated),
+		heartbeat:    15 * time.Second,
+		clientBuffer: sseClientBuffer,
+		size:         max(replaySize, 0),
+		clients:      make(map[chan Event]struct{}),
+		done:         make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// SetHeartbeat sets how often an idle stream sends a comment line to keep
+// proxies from closing the connection. 0 or less sends no heartbeats.
+func (s *EventStream) SetHeartbeat(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeat = interval
+}
+
+// SetClientBuffer sets how many events may queue up for a client that
+// reads slower than events arrive, 64 by default. A client whose queue is
+// full is disconnected and is replayed what it missed when it reconnects
+// with Last-Event-ID, as far as the replay buffer reaches, so the buffer
+// should hold the events of a whole refresh. It applies to streams opened
+// afterwards; sizes below 1 restore the default.
+func (s *EventStream) SetClientBuffer(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientBuffer = size
+	if size < 1 {
+		s.clientBuffer = sseClientBuffer
+	}
+}
+
+// Close ends every open stream and stops listening for events. It waits
+// for the handlers of open streams to return.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+
+	s.sub.Unsubscribe()
+	s.wg.Wait()
+}
+
+// run records aggregator events in the replay buffer and fans them out to
+// connected clients. Clients that fall behind are disconnected.
+func (s *EventStream) run() {
+	for event := range s.sub.C {
+		s.mu.Lock()
+		if s.size > 0 {
+			s.replay = append(s.replay, event)
+			if len(s.replay) > s.size {
+				s.replay = s.replay[len(s.replay)-s.size:]
+			}
+		}
+		for client := range s.clients {
+			select {
+			case client <- event:
+			default:
+				delete(s.clients, client)
+				close(client)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := EntryFilter{Tags: query["tag"], Categories: query["category"], Sources: query["source"]}
+
+	var lastID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		http.Error(w, "Event stream closed", http.StatusServiceUnavailable)
+		return
+	}
+	client := make(chan Event, s.clientBuffer)
+	s.clients[client] = struct{}{}
+	var missed []Event
+	if lastID > 0 {
+		for _, event := range s.replay {
+			if event.Seq > lastID {
+				missed = append(missed, event)
+			}
+		}
+	}
+	heartbeat := s.heartbeat
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	defer s.wg.Done()
+	defer s.removeClient(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range missed {
+		if filter.Match(*event.Entry) {
+			writeSSEEvent(w, event)
+		}
+	}
+	flusher.Flush()
+
+	var ticks <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case event, ok := <-client:
+			if !ok {
+				return
+			}
+			if !filter.Match(*event.Entry) {
+				continue
+			}
+			writeSSEEvent(w, event)
+			flusher.Flush()
+		case <-ticks:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// removeClient unregisters a client unless run already dropped it
+func (s *EventStream) removeClient(client chan Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[client]; ok {
+		delete(s.clients, client)
+		close(client)
+	}
+}
+
+// writeSSEEvent writes one event in the text/event-stream format
+func writeSSEEvent(w http.ResponseWriter, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+}
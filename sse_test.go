@@ -0,0 +1,70 @@
+package beam
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventStreamWithoutHeartbeat(t *testing.T) {
+	entries := testEntries(2)
+	var count atomic.Int32
+	count.Store(1)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feed := NewFeed("Source", "https://example.com/feed")
+		feed.Items = entries[len(entries)-int(count.Load()):]
+		data, _ := feed.Encode(FormatBEAM)
+		w.Write(data)
+	}))
+	defer source.Close()
+
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	if _, err := a.AddSource("Source", "", source.URL); err != nil {
+		t.Fatal(err)
+	}
+	a.FetchAllFeeds()
+
+	stream := NewEventStream(a, 10)
+	stream.SetHeartbeat(0)
+	server := httptest.NewServer(stream)
+	defer server.Close()
+	defer stream.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	count.Store(2)
+	a.FetchAllFeeds()
+
+	lines := make(chan string, 100)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream ended without an event")
+			}
+			if strings.HasPrefix(line, "event: ") {
+				if line != "event: "+string(EventEntryNew) {
+					t.Fatalf("got %q, want entry.new", line)
+				}
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package beam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AggregatorState is the part of an aggregator that survives restarts:
+// its sources with their fetch metadata, the history of entries seen, the
+// tombstones of entries gone from the aggregated feed and when it last
+// changed.
+type AggregatorState struct {
+	Sources     []FeedSource  `json:"sources"`
+	History     []EntryRecord `json:"history"`
+	Tombstones  []Tombstone   `json:"tombstones,omitempty"`
+	LastUpdated *time.Time    `json:"last_updated,omitempty"`
+	SavedAt     time.Time     `json:"saved_at"`
+}
+
+// Store persists aggregator state
+type Store interface {
+	// Load returns the saved state, or nil if nothing has been saved yet
+	Load() (*AggregatorState, error)
+	// Save replaces the saved state
+	Save(state *AggregatorState) error
+}
+
+// FileStore is a Store that keeps the state in a JSON file.
+// Writes go to a temporary file that is renamed into place, so a crash
+// never leaves a truncated state file behind.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore creates a store backed by the file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load implements Store
+func (s *FileStore) Load() (*AggregatorState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var state AggregatorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	return &state, nil
+}
+
+// Save implements Store
+func (s *FileStore) Save(state *AggregatorState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file in the same directory, so readers never see a partial write
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// MemoryStore is a Store that keeps the state in memory, for tests
+type MemoryStore struct {
+	data []byte
+	mu   sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Load implements Store. It returns a copy that is safe to modify.
+func (s *MemoryStore) Load() (*AggregatorState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data == nil {
+		return nil, nil
+	}
+	var state AggregatorState
+	if err := json.Unmarshal(s.data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Save implements Store. The state is copied, not retained.
+func (s *MemoryStore) Save(state *AggregatorState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	return nil
+}
+
+// SetStore attaches a store to the aggregator and restores the state saved
+// in it, so the last known feed is served immediately. Sources already
+// added (for example from a config file) are matched by URL and recover
+// their ID, fetch metadata and entry history; if none were added, the saved
+// sources are restored as they were. From then on the state is saved
+// after every fetch and every source change.
+func (a *Aggregator) SetStore(store Store) error {
+	state, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load aggregator state: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.store = store
+	if state == nil {
+		return nil
+	}
+
+	a.history.restore(state.History)
+	a.tombstones = state.Tombstones
+	if len(a.Sources) == 0 {
+		a.Sources = state.Sources
+	} else {
+		restoredIDs := make(map[string]bool)
+		for i := range a.Sources {
+			for _, saved := range state.Sources {
+				if normalizeSourceURL(saved.URL) != normalizeSourceURL(a.Sources[i].URL) &&
+					normalizeSourceURL(saved.HomePageURL) != normalizeSourceURL(a.Sources[i].URL) {
+					continue
+				}
+				configured := a.Sources[i]
+				restored := saved
+				restored.Name, restored.Description = configured.Name, configured.Description
+				restored.Group, restored.Tags = configured.Group, configured.Tags
+				restored.Disabled = configured.Disabled
+				if restored.Disabled {
+					restored.Status = "disabled"
+				}
+				a.Sources[i] = restored
+				restoredIDs[restored.ID] = true
+				break
+			}
+		}
+
+		// Forget the history of saved sources that are no longer configured
+		for id := range a.history.records {
+			if !restoredIDs[id] {
+				a.history.removeSource(id)
+			}
+		}
+	}
+
+	// Serve the last known feed right away, keeping its validators stable
+	a.rebuildLocked()
+	if state.LastUpdated != nil {
+		a.AggregatedFeed.LastUpdated = state.LastUpdated
+	}
+
+	fmt.Printf("Restored state with %d sources from %s\n", len(a.Sources), state.SavedAt.Local().Format(time.DateTime))
+	return nil
+}
+
+// SaveState writes the current state to the attached store and waits
+// until it and any state saved in the background are written
+func (a *Aggregator) SaveState() error {
+	a.mu.RLock()
+	if a.store == nil {
+		a.mu.RUnlock()
+		return errors.New("no store attached")
+	}
+	a.persister.save(a.store, a.stateLocked())
+	a.mu.RUnlock()
+
+	return a.persister.flush()
+}
+
+// stateLocked captures a snapshot of the persistent state.
+// The caller must hold a.mu.
+func (a *Aggregator) stateLocked() *AggregatorState {
+	return &AggregatorState{
+		Sources:     append([]FeedSource(nil), a.Sources...),
+		History:     a.history.all(),
+		Tombstones:  append([]Tombstone(nil), a.tombstones...),
+		LastUpdated: a.AggregatedFeed.LastUpdated,
+		SavedAt:     time.Now().UTC(),
+	}
+}
+
+// persistLocked saves a snapshot of the state in the background if a store
+// is attached. The caller must hold a.mu, which keeps the snapshots in order.
+func (a *Aggregator) persistLocked() {
+	if a.store == nil {
+		return
+	}
+	a.persister.save(a.store, a.stateLocked())
+}
+
+// statePersister writes state snapshots to a store in the background, so
+// fetches and requests never wait for the disk. A snapshot taken while
+// another is being written replaces any snapshot still waiting; only the
+// latest is written.
+type statePersister struct {
+	mu      sync.Mutex
+	store   Store
+	pending *AggregatorState
+	idle    chan struct{} // closed when the running writer finishes; nil if none runs
+	err     error         // error of the last write
+}
+
+// save queues a snapshot for writing
+func (p *statePersister) save(store Store, state *AggregatorState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.store, p.pending = store, state
+	if p.idle == nil {
+		p.idle = make(chan struct{})
+		go p.run(p.idle)
+	}
+}
+
+// run writes queued snapshots until none is left
+func (p *statePersister) run(idle chan struct{}) {
+	defer close(idle)
+	for {
+		p.mu.Lock()
+		store, state := p.store, p.pending
+		p.pending = nil
+		if state == nil {
+			p.idle = nil
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		err := store.Save(state)
+		if err != nil {
+			fmt.Printf("Failed to save aggregator state: %v\n", err)
+		}
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+	}
+}
+
+// flush waits until every queued snapshot is written and returns the
+// error of the last write
+func (p *statePersister) flush() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.mu.Unlock()
+	if idle != nil {
+		<-idle
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
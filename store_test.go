@@ -0,0 +1,61 @@
+package beam
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingStore is a MemoryStore whose writes wait until release is closed
+type blockingStore struct {
+	*MemoryStore
+	release chan struct{}
+}
+
+func (s blockingStore) Save(state *AggregatorState) error {
+	<-s.release
+	return s.MemoryStore.Save(state)
+}
+
+func TestStateIsSavedWithoutBlockingTheAggregator(t *testing.T) {
+	source := newTestSource(t, 3)
+	store := blockingStore{MemoryStore: NewMemoryStore(), release: make(chan struct{})}
+
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	if err := a.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.AddSource("Source", "", source.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fetches and requests go on while the store is busy
+	fetched := make(chan struct{})
+	go func() {
+		a.FetchAllFeeds()
+		a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(fetched)
+	}()
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("aggregator blocked on the store")
+	}
+
+	close(store.release)
+	if err := a.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The saved state restores the sources and their entries
+	restored := NewAggregator("Test", "https://example.com/aggregated")
+	if err := restored.SetStore(store.MemoryStore); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(restored.GetSources()); got != 1 {
+		t.Fatalf("restored %d sources, want 1", got)
+	}
+	if got := len(restored.EntryHistory()); got != 3 {
+		t.Fatalf("restored %d entries, want 3", got)
+	}
+}
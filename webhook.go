@@ -0,0 +1,396 @@
+package beam
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader carries the HMAC-SHA256 signature of a webhook body
+	WebhookSignatureHeader = "X-Beam-Signature"
+	// WebhookEventHeader carries the event type of a webhook delivery
+	WebhookEventHeader = "X-Beam-Event"
+	// WebhookDeliveryHeader carries the ID of a webhook delivery
+	WebhookDeliveryHeader = "X-Beam-Delivery"
+
+	// maxDeliveryLog bounds the number of deliveries kept in the log
+	maxDeliveryLog = 1000
+	// webhookEventBuffer is how many events may queue up while deliveries
+	// are being started before further events are dropped
+	webhookEventBuffer = 1024
+)
+
+// Delivery statuses reported in WebhookDelivery.Status
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint that receives aggregated entries as JSON POSTs.
+// Events defaults to new and updated entries. When Secret is set, each
+// body is signed with HMAC-SHA256 in the X-Beam-Signature header.
+type Webhook struct {
+	ID     string      `json:"id"`
+	URL    string      `json:"url"`
+	Secret string      `json:"-"`
+	Events []EventType `json:"events,omitempty"`
+	Filter EntryFilter `json:"filter"`
+}
+
+// WebhookPayload is the JSON body POSTed to webhooks
+type WebhookPayload struct {
+	DeliveryID string        `json:"delivery_id"`
+	Event      EventType     `json:"event"`
+	Time       time.Time     `json:"time"`
+	SourceID   string        `json:"source_id"`
+	Entry      Entry         `json:"entry"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+}
+
+// WebhookDelivery records the attempts to deliver one payload to one webhook
+type WebhookDelivery struct {
+	ID          string     `json:"id"`
+	WebhookID   string     `json:"webhook_id"`
+	Event       EventType  `json:"event"`
+	EntryID     string     `json:"entry_id"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	StatusCode  int        `json:"status_code,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	body []byte
+}
+
+// WebhookDispatcher POSTs new and updated aggregated entries to webhooks.
+// Failed deliveries are retried with exponential backoff; every delivery
+// is kept in a bounded log from which it can be replayed.
+type WebhookDispatcher struct {
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	mu         sync.Mutex
+	webhooks   map[string]Webhook
+	deliveries []*WebhookDelivery
+
+	sub    *Subscription
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWebhookDispatcher creates a dispatcher delivering the entry events of
+// the aggregator. Call Close to stop it.
+func NewWebhookDispatcher(a *Aggregator) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &WebhookDispatcher{
+		client:         &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:    5,
+		initialBackoff: time.Second,
+		maxBackoff:     time.Minute,
+		webhooks:       make(map[string]Webhook),
+		sub:            a.Subscribe(webhookEventBuffer, EventEntryNew, EventEntryUpdated, EventEntryRemoved),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+// SetRetryPolicy sets how many times a delivery is attempted and the
+// backoff before the first retry, which doubles up to one minute
+func (d *WebhookDispatcher) SetRetryPolicy(maxAttempts int, initialBackoff time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxAttempts, d.initialBackoff = max(maxAttempts, 1), initialBackoff
+}
+
+// AddWebhook registers a webhook and returns its ID
+func (d *WebhookDispatcher) AddWebhook(hook Webhook) (string, error) {
+	if !isValidURL(hook.URL) {
+		return "", NewError("url", "url must be a valid URL")
+	}
+	if len(hook.Events) == 0 {
+		hook.Events = []EventType{EventEntryNew, EventEntryUpdated}
+	}
+	for _, eventType := range hook.Events {
+		if !strings.HasPrefix(string(eventType), "entry.") {
+			return "", NewError("events", fmt.Sprintf("unsupported webhook event: %s", eventType))
+		}
+	}
+	if hook.ID == "" {
+		hook.ID = randomID()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.webhooks[hook.ID] = hook
+	return hook.ID, nil
+}
+
+// RemoveWebhook unregisters a webhook. Deliveries already in flight finish.
+func (d *WebhookDispatcher) RemoveWebhook(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.webhooks[id]; !ok {
+		return fmt.Errorf("webhook not found: %s", id)
+	}
+	delete(d.webhooks, id)
+	return nil
+}
+
+// Webhooks returns the registered webhooks
+func (d *WebhookDispatcher) Webhooks() []Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hooks := make([]Webhook, 0, len(d.webhooks))
+	for _, hook := range d.webhooks {
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// Deliveries returns the delivery log, oldest first
+func (d *WebhookDispatcher) Deliveries() []WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	log := make([]WebhookDelivery, 0, len(d.deliveries))
+	for _, delivery := range d.deliveries {
+		log = append(log, *delivery)
+	}
+	return log
+}
+
+// Dropped returns how many events were dropped without being delivered
+// because they arrived faster than the dispatcher could take them
+func (d *WebhookDispatcher) Dropped() uint64 {
+	return d.sub.Dropped()
+}
+
+// Replay sends a logged delivery again, with the same payload and a fresh
+// set of attempts. The webhook must still be registered, and deliveries
+// still being attempted cannot be replayed.
+func (d *WebhookDispatcher) Replay(deliveryID string) error {
+	d.mu.Lock()
+	var delivery *WebhookDelivery
+	for _, candidate := range d.deliveries {
+		if candidate.ID == deliveryID {
+			delivery = candidate
+		}
+	}
+	if delivery == nil {
+		d.mu.Unlock()
+		return fmt.Errorf("delivery not found: %s", deliveryID)
+	}
+	if delivery.Status == DeliveryPending {
+		d.mu.Unlock()
+		return fmt.Errorf("delivery still pending: %s", deliveryID)
+	}
+	hook, ok := d.webhooks[delivery.WebhookID]
+	if !ok {
+		d.mu.Unlock()
+		return fmt.Errorf("webhook not found: %s", delivery.WebhookID)
+	}
+	delivery.Status, delivery.Attempts, delivery.Error = DeliveryPending, 0, ""
+	delivery.StatusCode, delivery.CompletedAt = 0, nil
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go d.deliver(hook, delivery)
+	return nil
+}
+
+// Close stops listening for events and abandons pending retries
+func (d *WebhookDispatcher) Close() {
+	d.sub.Unsubscribe()
+	d.cancel()
+	d.wg.Wait()
+}
+
+// run turns aggregator events into deliveries for every matching webhook
+func (d *WebhookDispatcher) run() {
+	defer d.wg.Done()
+
+	var dropped uint64
+	for event := range d.sub.C {
+		if n := d.sub.Dropped(); n > dropped {
+			fmt.Printf("Webhook dispatcher dropped %d events\n", n-dropped)
+			dropped = n
+		}
+		if event.Entry == nil {
+			continue
+		}
+
+		d.mu.Lock()
+		var hooks []Webhook
+		for _, hook := range d.webhooks {
+			if webhookWants(hook, event) {
+				hooks = append(hooks, hook)
+			}
+		}
+		d.mu.Unlock()
+
+		for _, hook := range hooks {
+			delivery, err := d.newDelivery(hook, event)
+			if err != nil {
+				fmt.Printf("Webhook %s: %v\n", hook.ID, err)
+				continue
+			}
+			d.wg.Add(1)
+			go d.deliver(hook, delivery)
+		}
+	}
+}
+
+// webhookWants reports whether a webhook subscribes to an event
+func webhookWants(hook Webhook, event Event) bool {
+	for _, eventType := range hook.Events {
+		if eventType == event.Type {
+			return hook.Filter.Match(*event.Entry)
+		}
+	}
+	return false
+}
+
+// newDelivery encodes the payload of an event and logs the delivery
+func (d *WebhookDispatcher) newDelivery(hook Webhook, event Event) (*WebhookDelivery, error) {
+	payload := WebhookPayload{
+		DeliveryID: randomID(),
+		Event:      event.Type,
+		Time:       event.Time,
+		SourceID:   event.SourceID,
+		Entry:      *event.Entry,
+		Changes:    event.Changes,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	delivery := &WebhookDelivery{
+		ID:        payload.DeliveryID,
+		WebhookID: hook.ID,
+		Event:     event.Type,
+		EntryID:   event.Entry.ID,
+		Status:    DeliveryPending,
+		CreatedAt: time.Now(),
+		body:      body,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > maxDeliveryLog {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxDeliveryLog:]
+	}
+	return delivery, nil
+}
+
+// deliver POSTs a delivery until it succeeds, fails permanently or runs
+// out of attempts
+func (d *WebhookDispatcher) deliver(hook Webhook, delivery *WebhookDelivery) {
+	defer d.wg.Done()
+
+	d.mu.Lock()
+	maxAttempts, backoff := d.maxAttempts, d.initialBackoff
+	d.mu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		statusCode, err := d.post(hook, delivery)
+		retryable := err != nil || statusCode == http.StatusTooManyRequests || statusCode >= 500
+
+		d.mu.Lock()
+		delivery.Attempts, delivery.StatusCode = attempt, statusCode
+		delivery.Error = ""
+		switch {
+		case err != nil:
+			delivery.Error = err.Error()
+		case statusCode < 200 || statusCode >= 300:
+			delivery.Error = fmt.Sprintf("HTTP error: %d", statusCode)
+		default:
+			delivery.Status = DeliveryDelivered
+		}
+		if delivery.Status == DeliveryPending && (!retryable || attempt >= maxAttempts) {
+			delivery.Status = DeliveryFailed
+		}
+		if delivery.Status != DeliveryPending {
+			now := time.Now()
+			delivery.CompletedAt = &now
+		}
+		done := delivery.Status != DeliveryPending
+		d.mu.Unlock()
+
+		if done {
+			return
+		}
+
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, d.maxBackoff)
+	}
+}
+
+// post sends one attempt of a delivery
+func (d *WebhookDispatcher) post(hook Webhook, delivery *WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(delivery.Event))
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	if hook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(hook.Secret, delivery.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload returns the X-Beam-Signature header value for body
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature reports whether signature is a valid
+// X-Beam-Signature header value for body, for use by webhook receivers
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhookPayload(secret, body)), []byte(signature))
+}
+
+// randomID returns a random 128-bit hex identifier
+func randomID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,99 @@
+package beam
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	// The source starts with entries 1 and 2; entry 0 is published later
+	entries := testEntries(3)
+	var count atomic.Int32
+	count.Store(2)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feed := NewFeed("Source", "https://example.com/feed")
+		feed.Items = entries[len(entries)-int(count.Load()):]
+		data, _ := feed.Encode(FormatBEAM)
+		w.Write(data)
+	}))
+	defer source.Close()
+
+	const secret = "s3cret"
+	received := make(chan WebhookPayload, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !VerifyWebhookSignature(secret, body, r.Header.Get(WebhookSignatureHeader)) {
+			t.Errorf("invalid signature %q", r.Header.Get(WebhookSignatureHeader))
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	d := NewWebhookDispatcher(a)
+	defer d.Close()
+	if _, err := d.AddWebhook(Webhook{URL: receiver.URL, Secret: secret}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.AddSource("Source", "", source.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entries of the first fetch are not new
+	a.FetchAllFeeds()
+	count.Store(3)
+	a.FetchAllFeeds()
+
+	select {
+	case payload := <-received:
+		if payload.Event != EventEntryNew || payload.Entry.ID != "0" {
+			t.Fatalf("received %s for %s, want entry.new for 0", payload.Event, payload.Entry.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	select {
+	case payload := <-received:
+		t.Fatalf("unexpected delivery of %s for %s", payload.Event, payload.Entry.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The delivery is logged as complete and can be replayed
+	var delivery WebhookDelivery
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		deliveries := d.Deliveries()
+		if len(deliveries) != 1 {
+			t.Fatalf("logged %d deliveries, want 1", len(deliveries))
+		}
+		if delivery = deliveries[0]; delivery.Status != DeliveryPending || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if delivery.Status != DeliveryDelivered || delivery.CompletedAt == nil {
+		t.Fatalf("delivery = %+v, want delivered", delivery)
+	}
+	if err := d.Replay(delivery.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case payload := <-received:
+		if payload.DeliveryID != delivery.ID {
+			t.Fatalf("replayed delivery %s, want %s", payload.DeliveryID, delivery.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no replayed delivery")
+	}
+	if d.Dropped() != 0 {
+		t.Fatalf("dropped %d events", d.Dropped())
+	}
+}
@@ -0,0 +1,402 @@
+package beam
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// websubLease is the subscription lease requested from hubs
+	websubLease = 7 * 24 * time.Hour
+	// websubRenewBefore is how long before its lease ends a subscription
+	// is renewed; from then on the source is polled again
+	websubRenewBefore = time.Hour
+	// maxPushSize bounds the size of content accepted from a hub
+	maxPushSize = 10 << 20
+)
+
+// WebSub subscription states
+const (
+	websubPending       = "pending"
+	websubActive        = "active"
+	websubUnsubscribing = "unsubscribing"
+)
+
+// PingHub tells the feed's WebSub hub that the feed changed, so the hub
+// fetches it and pushes the new content to subscribers
+func (f *Feed) PingHub() error {
+	if f.Hub == "" {
+		return errors.New("feed has no hub")
+	}
+	return pingHub(f.Hub, f.FeedURL)
+}
+
+// notifyHub pings the feed's hub in the background, if it has one. While
+// a Publisher applies an update, the ping is held back until the new
+// version is published.
+func (f *Feed) notifyHub() {
+	if f.Hub == "" {
+		return
+	}
+	if f.holdPing {
+		f.pingHeld = true
+		return
+	}
+	hub, topic := f.Hub, f.FeedURL
+	go func() {
+		if err := pingHub(hub, topic); err != nil {
+			fmt.Printf("WebSub ping to %s failed: %v\n", hub, err)
+		}
+	}()
+}
+
+// pingHub sends a publish notification for topic to a hub
+func pingHub(hub, topic string) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.PostForm(hub, url.Values{
+		"hub.mode": {"publish"},
+		"hub.url":  {topic},
+	})
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+	}
+	return nil
+}
+
+// websubSubscription is the aggregator's subscription to one source
+type websubSubscription struct {
+	hub     string
+	topic   string
+	secret  string
+	state   string
+	expires time.Time
+}
+
+// websubSubscriber tracks the WebSub subscriptions of an aggregator.
+// It is guarded by the aggregator's mutex.
+type websubSubscriber struct {
+	callbackURL string
+	subs        map[string]*websubSubscription // by source ID
+}
+
+// isPushed reports whether a source has a verified subscription that does
+// not need renewing yet
+func (s *websubSubscriber) isPushed(sourceID string, now time.Time) bool {
+	sub, ok := s.subs[sourceID]
+	return ok && sub.state == websubActive && sub.expires.After(now.Add(websubRenewBefore))
+}
+
+// callbackFor returns the callback URL registered with hubs for a source
+func (s *websubSubscriber) callbackFor(sourceID string) string {
+	return withQuery(s.callbackURL, "source", sourceID)
+}
+
+// EnableWebSub makes the aggregator subscribe to sources that advertise a
+// WebSub hub, so their updates are pushed instead of polled. callbackURL
+// is the public URL at which WebSubCallback is served. Subscriptions are
+// requested when a source is next fetched.
+func (a *Aggregator) EnableWebSub(callbackURL string) error {
+	if !isValidURL(callbackURL) {
+		return NewError("callback_url", "callback_url must be a valid URL")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.websub.callbackURL = callbackURL
+	if a.websub.subs == nil {
+		a.websub.subs = make(map[string]*websubSubscription)
+	}
+	return nil
+}
+
+// subscribeLocked subscribes to the hub of a source unless a subscription
+// is already pending or does not need renewing yet. An empty topic keeps
+// the topic of the current subscription. The caller must hold a.mu.
+func (a *Aggregator) subscribeLocked(src FeedSource, topic string) {
+	if a.websub.callbackURL == "" || src.Hub == "" {
+		return
+	}
+
+	current := a.websub.subs[src.ID]
+	if topic == "" {
+		if current == nil {
+			return
+		}
+		topic = current.topic
+	}
+
+	sub := &websubSubscription{hub: src.Hub, topic: topic, secret: randomID(), state: websubPending}
+	if current != nil && current.hub == src.Hub && current.topic == topic && current.state != websubUnsubscribing {
+		if current.state == websubPending || a.websub.isPushed(src.ID, time.Now()) {
+			return
+		}
+		// Renewing keeps the secret, so pushes signed with it stay valid
+		sub.secret, sub.state, sub.expires = current.secret, current.state, current.expires
+	}
+	a.websub.subs[src.ID] = sub
+
+	callback := a.websub.callbackFor(src.ID)
+	go func() {
+		err := requestSubscription(sub.hub, "subscribe", sub.topic, callback, sub.secret)
+		if err == nil {
+			fmt.Printf("Requested WebSub subscription to %s at %s\n", sub.topic, sub.hub)
+			return
+		}
+		fmt.Printf("WebSub subscription to %s failed: %v\n", sub.topic, err)
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.websub.subs[src.ID] == sub && sub.state == websubPending {
+			delete(a.websub.subs, src.ID)
+		}
+	}()
+}
+
+// unsubscribeLocked ends the subscription of a source, if any.
+// The caller must hold a.mu.
+func (a *Aggregator) unsubscribeLocked(sourceID string) {
+	sub, ok := a.websub.subs[sourceID]
+	if !ok || sub.state == websubUnsubscribing {
+		return
+	}
+	sub.state = websubUnsubscribing
+
+	callback := a.websub.callbackFor(sourceID)
+	go func() {
+		if err := requestSubscription(sub.hub, "unsubscribe", sub.topic, callback, ""); err != nil {
+			fmt.Printf("WebSub unsubscription from %s failed: %v\n", sub.topic, err)
+
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if a.websub.subs[sourceID] == sub {
+				delete(a.websub.subs, sourceID)
+			}
+		}
+	}()
+}
+
+// requestSubscription sends a subscribe or unsubscribe request to a hub
+func requestSubscription(hub, mode, topic, callback, secret string) error {
+	form := url.Values{
+		"hub.mode":     {mode},
+		"hub.topic":    {topic},
+		"hub.callback": {callback},
+	}
+	if mode == "subscribe" {
+		form.Set("hub.lease_seconds", strconv.Itoa(int(websubLease.Seconds())))
+		form.Set("hub.secret", secret)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.PostForm(hub, form)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+	}
+	return nil
+}
+
+// WebSubCallback handles the requests hubs send to the callback URL given
+// to EnableWebSub: intent verification of subscriptions and delivery of
+// pushed content, which is ingested immediately.
+func (a *Aggregator) WebSubCallback(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.verifyWebSubIntent(w, r)
+	case http.MethodPost:
+		a.receiveWebSubContent(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verifyWebSubIntent confirms subscription requests the aggregator made by
+// echoing the hub's challenge, and refuses any other
+func (a *Aggregator) verifyWebSubIntent(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sourceID := query.Get("source")
+	mode, topic, challenge := query.Get("hub.mode"), query.Get("hub.topic"), query.Get("hub.challenge")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sub, ok := a.websub.subs[sourceID]
+	if !ok || sub.topic != topic {
+		http.Error(w, "Unknown subscription", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case mode == "denied":
+		fmt.Printf("WebSub subscription to %s denied: %s\n", topic, query.Get("hub.reason"))
+		delete(a.websub.subs, sourceID)
+		w.WriteHeader(http.StatusOK)
+		return
+	case challenge == "":
+		http.Error(w, "Missing hub.challenge", http.StatusBadRequest)
+		return
+	case mode == "subscribe" && sub.state != websubUnsubscribing:
+		lease := websubLease
+		if seconds, err := strconv.Atoi(query.Get("hub.lease_seconds")); err == nil && seconds > 0 {
+			lease = time.Duration(seconds) * time.Second
+		}
+		sub.state, sub.expires = websubActive, time.Now().Add(lease)
+		fmt.Printf("WebSub subscription to %s active until %s\n", topic, sub.expires.Format(time.DateTime))
+	case mode == "unsubscribe" && sub.state == websubUnsubscribing:
+		delete(a.websub.subs, sourceID)
+	default:
+		http.Error(w, "Unexpected hub.mode", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, challenge)
+}
+
+// receiveWebSubContent ingests content pushed by a hub. Content without a
+// valid X-Hub-Signature is acknowledged but ignored, as WebSub requires.
+func (a *Aggregator) receiveWebSubContent(w http.ResponseWriter, r *http.Request) {
+	sourceID := r.URL.Query().Get("source")
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPushSize))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.RLock()
+	sub, ok := a.websub.subs[sourceID]
+	var secret, topic string
+	if ok && sub.state != websubUnsubscribing {
+		secret, topic = sub.secret, sub.topic
+	}
+	a.mu.RUnlock()
+
+	if secret == "" {
+		http.Error(w, "Unknown subscription", http.StatusGone)
+		return
+	}
+	if !verifyHubSignature(secret, body, r.Header.Get("X-Hub-Signature")) {
+		fmt.Printf("Ignored WebSub content for %s: invalid signature\n", topic)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	feed, err := ParseFeed(body, topic)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("feed parse error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	a.ingestPush(sourceID, feed)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ingestPush adds pushed entries to the history of a source and rebuilds
+// the aggregated feed. Pushed content may hold only the new entries, so
+// entries missing from it are not reported as removed.
+func (a *Aggregator) ingestPush(sourceID string, feed *Feed) {
+	a.mu.Lock()
+	i := a.sourceIndexLocked(sourceID)
+	if i < 0 || a.Sources[i].Disabled {
+		a.mu.Unlock()
+		return
+	}
+
+	src := &a.Sources[i]
+	src.LastFetch = time.Now()
+	src.Status = "active"
+	src.ErrorMsg = ""
+
+	var changesets []Changeset
+	a.sanitizeLocked(feed.Items)
+	retracted := a.history.retract(src.ID, feed.Tombstones)
+	changeset := a.history.merge(src.ID, feed.Items, src.LastFetch)
+	changeset.addRetracted(retracted)
+	if !changeset.IsEmpty() {
+		changesets = append(changesets, changeset)
+	}
+	fmt.Printf("✓ Received %d pushed entries from %s (%d new, %d updated, %d removed)\n",
+		len(feed.Items), src.Name, len(changeset.New), len(changeset.Updated), len(changeset.Removed))
+	a.publishSourceEvent(EventFetchSucceeded, *src, nil)
+
+	a.finishRefreshLocked(changesets)
+	a.mu.Unlock()
+
+	a.notifyChanges(changesets)
+}
+
+// verifyHubSignature checks an X-Hub-Signature header of the form
+// "method=hexdigest" against the HMAC of body
+func verifyHubSignature(secret string, body []byte, header string) bool {
+	method, signature, ok := strings.Cut(header, "=")
+	if !ok || secret == "" {
+		return false
+	}
+
+	var newHash func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+// linkHeaderTarget returns the target of the first Link header of resp
+// with the given relation, resolved against the request URL
+func linkHeaderTarget(resp *http.Response, rel string) string {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+			if !ok || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(key, "rel") || !hasToken(strings.Trim(value, `"`), rel) {
+					continue
+				}
+				href, err := resp.Request.URL.Parse(strings.Trim(target, "<>"))
+				if err != nil {
+					break
+				}
+				return href.String()
+			}
+		}
+	}
+	return ""
+}
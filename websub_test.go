@@ -0,0 +1,229 @@
+package beam
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testTopic = "https://example.com/feed"
+
+// newWebSubAggregator returns an aggregator with WebSub enabled and a
+// subscription of source "src" to testTopic in the given state
+func newWebSubAggregator(t *testing.T, state string) (*Aggregator, *websubSubscription) {
+	t.Helper()
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	if err := a.EnableWebSub("https://example.com/websub"); err != nil {
+		t.Fatal(err)
+	}
+	sub := &websubSubscription{hub: "https://hub.example.com/", topic: testTopic, secret: "secret", state: state}
+	if state == websubActive {
+		sub.expires = time.Now().Add(websubLease)
+	}
+	a.websub.subs["src"] = sub
+	return a, sub
+}
+
+// verifyIntent sends an intent verification to the aggregator's callback
+func verifyIntent(a *Aggregator, sourceID string, query url.Values) *httptest.ResponseRecorder {
+	query.Set("source", sourceID)
+	rec := httptest.NewRecorder()
+	a.WebSubCallback(rec, httptest.NewRequest(http.MethodGet, "/websub?"+query.Encode(), nil))
+	return rec
+}
+
+// push sends content to the aggregator's callback with the given signature
+func push(a *Aggregator, sourceID string, body []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/websub?source="+sourceID, bytes.NewReader(body))
+	if signature != "" {
+		req.Header.Set("X-Hub-Signature", signature)
+	}
+	rec := httptest.NewRecorder()
+	a.WebSubCallback(rec, req)
+	return rec
+}
+
+// sign returns the X-Hub-Signature of body for secret
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebSubIntentVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    string
+		sourceID string
+		query    url.Values
+		code     int
+		echoed   bool
+	}{
+		{"pending subscription", websubPending, "src",
+			url.Values{"hub.mode": {"subscribe"}, "hub.topic": {testTopic}, "hub.challenge": {"c"}, "hub.lease_seconds": {"3600"}},
+			http.StatusOK, true},
+		{"other topic", websubPending, "src",
+			url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://evil.example/feed"}, "hub.challenge": {"c"}},
+			http.StatusNotFound, false},
+		{"unknown source", websubPending, "other",
+			url.Values{"hub.mode": {"subscribe"}, "hub.topic": {testTopic}, "hub.challenge": {"c"}},
+			http.StatusNotFound, false},
+		{"missing challenge", websubPending, "src",
+			url.Values{"hub.mode": {"subscribe"}, "hub.topic": {testTopic}},
+			http.StatusBadRequest, false},
+		{"unsubscribe not requested", websubActive, "src",
+			url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {testTopic}, "hub.challenge": {"c"}},
+			http.StatusNotFound, false},
+		{"unsubscribe requested", websubUnsubscribing, "src",
+			url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {testTopic}, "hub.challenge": {"c"}},
+			http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		a, _ := newWebSubAggregator(t, tt.state)
+		rec := verifyIntent(a, tt.sourceID, tt.query)
+		if rec.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.code)
+		}
+		if echoed := rec.Body.String() == "c"; echoed != tt.echoed {
+			t.Errorf("%s: body %q, challenge echoed = %v, want %v", tt.name, rec.Body.String(), echoed, tt.echoed)
+		}
+	}
+}
+
+func TestWebSubVerificationActivatesSubscription(t *testing.T) {
+	a, sub := newWebSubAggregator(t, websubPending)
+	verifyIntent(a, "src", url.Values{
+		"hub.mode": {"subscribe"}, "hub.topic": {testTopic}, "hub.challenge": {"c"}, "hub.lease_seconds": {"7200"},
+	})
+	if sub.state != websubActive {
+		t.Fatalf("state = %s, want active", sub.state)
+	}
+	if lease := time.Until(sub.expires); lease > 2*time.Hour || lease < time.Hour {
+		t.Fatalf("subscription expires in %s, want the 2h lease", lease)
+	}
+	if !a.websub.isPushed("src", time.Now()) {
+		t.Fatal("source with an active subscription is still polled")
+	}
+
+	// A denial ends the subscription
+	verifyIntent(a, "src", url.Values{"hub.mode": {"denied"}, "hub.topic": {testTopic}})
+	if _, ok := a.websub.subs["src"]; ok {
+		t.Fatal("denied subscription kept")
+	}
+}
+
+// newPushedSource returns an aggregator with a source whose feed holds
+// entries 0 to 2, fetched once, and an active subscription for it
+func newPushedSource(t *testing.T) (*Aggregator, string) {
+	t.Helper()
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	if err := a.EnableWebSub("https://example.com/websub"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := a.AddSource("Source", "", newTestSource(t, 3).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.FetchAllFeeds()
+	a.websub.subs[id] = &websubSubscription{topic: testTopic, secret: "secret", state: websubActive, expires: time.Now().Add(websubLease)}
+	return a, id
+}
+
+// pushedFeed returns a feed document holding only entry "new"
+func pushedFeed(t *testing.T) []byte {
+	t.Helper()
+	feed := NewFeed("Source", testTopic)
+	feed.AddEntry(NewEntry("new", "New", "https://example.com/new", time.Now()))
+	data, err := feed.Encode(FormatBEAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWebSubPushRequiresSignature(t *testing.T) {
+	a, id := newPushedSource(t)
+	body := pushedFeed(t)
+	for _, signature := range []string{"", "sha256=0000", sign("wrong", body), "md5=" + sign("secret", body)[len("sha256="):]} {
+		rec := push(a, id, body, signature)
+		// Hubs must not learn whether the signature was valid
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("signature %q: status = %d, want 202", signature, rec.Code)
+		}
+		if len(a.AggregatedFeed.Items) != 3 {
+			t.Fatalf("signature %q: content ingested", signature)
+		}
+	}
+}
+
+func TestWebSubPushForUnknownSourceIsGone(t *testing.T) {
+	a, _ := newPushedSource(t)
+	body := pushedFeed(t)
+	if rec := push(a, "unknown", body, sign("secret", body)); rec.Code != http.StatusGone {
+		t.Fatalf("status = %d, want 410", rec.Code)
+	}
+}
+
+func TestWebSubPushMergesEntries(t *testing.T) {
+	a, id := newPushedSource(t)
+	body := pushedFeed(t)
+	if rec := push(a, id, body, sign("secret", body)); rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", rec.Code)
+	}
+
+	if n := len(a.AggregatedFeed.Items); n != 4 {
+		t.Fatalf("aggregated feed has %d entries, want 4", n)
+	}
+	changes := a.LastChanges()
+	if len(changes) != 1 || len(changes[0].New) != 1 || changes[0].New[0] != "new" {
+		t.Fatalf("changes = %+v, want entry new", changes)
+	}
+	if len(changes[0].Removed) != 0 {
+		t.Fatalf("entries missing from the push reported as removed: %v", changes[0].Removed)
+	}
+	for _, record := range a.SourceHistory(id) {
+		if !record.InFeed {
+			t.Fatalf("entry %s no longer marked as in the feed", record.Entry.ID)
+		}
+	}
+}
+
+func TestWebSubLapsedLeaseFallsBackToPolling(t *testing.T) {
+	var fetches atomic.Int32
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		data, _ := NewFeed("Source", testTopic).Encode(FormatBEAM)
+		w.Write(data)
+	}))
+	defer source.Close()
+
+	a := NewAggregator("Test", "https://example.com/aggregated")
+	if err := a.EnableWebSub("https://example.com/websub"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := a.AddSource("Source", "", source.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := &websubSubscription{topic: testTopic, secret: "secret", state: websubActive, expires: time.Now().Add(websubLease)}
+	a.websub.subs[id] = sub
+
+	a.fetchFeeds(true)
+	if n := fetches.Load(); n != 0 {
+		t.Fatalf("pushed source polled %d times", n)
+	}
+
+	// Within websubRenewBefore of the lease's end the source is polled again
+	sub.expires = time.Now().Add(websubRenewBefore / 2)
+	a.fetchFeeds(true)
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("source with a lapsing lease polled %d times, want 1", n)
+	}
+}